@@ -0,0 +1,206 @@
+// Command configcrypt encrypts, decrypts and re-encrypts values in TOML
+// and .env files in place, preserving the rest of the file.
+//
+// Usage:
+//
+//	configcrypt genkey
+//	configcrypt encrypt -keys password,server.token config.toml
+//	configcrypt decrypt [-keys DB_PASSWORD] .env.prod
+//	configcrypt rotate -new-key-file new.key config.toml
+//
+// Encryption keys are read from the file specified with -key-file flag,
+// or from CONFIG_KEY / CONFIG_KEY_FILE environment variables.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fednep/goapilib/config"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s genkey|encrypt|decrypt|rotate [flags] FILE\n", filepath.Base(os.Args[0]))
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := run(os.Args[1], os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(cmd string, args []string) error {
+
+	if cmd == "genkey" {
+		key, err := config.GenerateKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println(key)
+		return nil
+	}
+
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	keyFile := fs.String("key-file", "", "File with encryption keys (default: from CONFIG_KEY or CONFIG_KEY_FILE)")
+	keyList := fs.String("keys", "", "Comma-separated list of keys (env names or dotted TOML keys) to process")
+	newKeyFile := fs.String("new-key-file", "", "File with the new encryption key (rotate only)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		usage()
+		return errors.New("exactly one file should be specified")
+	}
+	fn := fs.Arg(0)
+
+	keys, err := loadKeys(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	selected := map[string]bool{}
+	for _, k := range strings.Split(*keyList, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			selected[k] = true
+		}
+	}
+
+	var transform func(key, val string) (string, bool, error)
+
+	switch cmd {
+	case "encrypt":
+		if len(selected) == 0 {
+			return errors.New("-keys should be specified for encrypt")
+		}
+
+		transform = func(key, val string) (string, bool, error) {
+			if !selected[key] || config.IsEncrypted(val) {
+				return val, false, nil
+			}
+			res, err := config.Encrypt(val, key, keys[0])
+			return res, true, err
+		}
+
+	case "decrypt":
+		transform = func(key, val string) (string, bool, error) {
+			if (len(selected) > 0 && !selected[key]) || !config.IsEncrypted(val) {
+				return val, false, nil
+			}
+			res, err := config.Decrypt(val, key, keys...)
+			if err != nil {
+				return "", false, fmt.Errorf("%s: %w", key, err)
+			}
+			return res, true, nil
+		}
+
+	case "rotate":
+		if *newKeyFile == "" {
+			return errors.New("-new-key-file should be specified for rotate")
+		}
+
+		newKeys, err := config.LoadKeyFile(*newKeyFile)
+		if err != nil {
+			return err
+		}
+
+		transform = func(key, val string) (string, bool, error) {
+			if (len(selected) > 0 && !selected[key]) || !config.IsEncrypted(val) {
+				return val, false, nil
+			}
+			plain, err := config.Decrypt(val, key, keys...)
+			if err != nil {
+				return "", false, fmt.Errorf("%s: %w", key, err)
+			}
+			res, err := config.Encrypt(plain, key, newKeys[0])
+			return res, true, err
+		}
+
+	default:
+		usage()
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+
+	return rewriteFile(fn, selected, transform)
+}
+
+func loadKeys(keyFile string) ([][]byte, error) {
+	if keyFile != "" {
+		return config.LoadKeyFile(keyFile)
+	}
+
+	return config.LoadKeys()
+}
+
+// rewriteFile applies transform to the values of the file and writes it back
+// preserving file permissions. Format is detected from the file extension.
+// Returns an error if any of the selected keys is not found in the file.
+func rewriteFile(fn string, selected map[string]bool, transform transformFunc) error {
+	st, err := os.Stat(fn)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+
+	rewrite := rewriteEnv
+	if strings.EqualFold(filepath.Ext(fn), ".toml") {
+		rewrite = rewriteToml
+	}
+
+	found := map[string]bool{}
+	res, count, err := rewrite(string(data), func(key, val string) (string, bool, error) {
+		found[key] = true
+		return transform(key, val)
+	})
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for key := range selected {
+		if !found[key] {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%s: %s not found, only single-line string values are supported",
+			fn, strings.Join(missing, ", "))
+	}
+
+	if count == 0 {
+		fmt.Fprintf(os.Stderr, "No values changed in %s\n", fn)
+		return nil
+	}
+
+	// Write into the temporary file first, so the original file
+	// is not corrupted if something goes wrong
+	tmp := fn + ".tmp"
+	if err := os.WriteFile(tmp, []byte(res), st.Mode().Perm()); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, fn); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d value(s) changed in %s\n", count, fn)
+	return nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+type transformFunc func(key, val string) (string, bool, error)
+
+var (
+	envLineRe = regexp.MustCompile(`^(\s*)(\w+)(\s*=\s*)(?:"(.*)"|(.*?))(\s*)$`)
+
+	// Part of dotted key: bare, quoted or literal
+	tomlKeyPartRe = regexp.MustCompile(`[A-Za-z0-9_-]+|"(?:[^"\\]|\\.)*"|'[^']*'`)
+
+	tomlKey     = `(?:` + tomlKeyPartRe.String() + `)(?:\s*\.\s*(?:` + tomlKeyPartRe.String() + `))*`
+	tomlTableRe = regexp.MustCompile(`^\s*\[\[?\s*(` + tomlKey + `)\s*\]\]?\s*(?:#.*)?$`)
+	tomlLineRe  = regexp.MustCompile(`^(\s*)(` + tomlKey + `)(\s*=\s*)("(?:[^"\\]|\\.)*"|'[^']*')(\s*(?:#.*)?)$`)
+)
+
+// rewriteEnv applies transform to the values of .env file.
+// Lines which don't contain key=value pairs are left intact. Values with
+// line breaks or quotes are not supported, as .env files are read without
+// unescaping (see config.EnvFileSource).
+func rewriteEnv(data string, transform transformFunc) (string, int, error) {
+	lines := strings.Split(data, "\n")
+	count := 0
+
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		sm := envLineRe.FindStringSubmatch(line)
+		if sm == nil {
+			continue
+		}
+
+		quoted := strings.HasSuffix(strings.TrimSpace(line), `"`) && sm[4] != ""
+		val := sm[5]
+		if quoted {
+			val = sm[4]
+		}
+
+		res, changed, err := transform(sm[2], val)
+		if err != nil {
+			return "", 0, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		if !changed {
+			continue
+		}
+
+		// .env files are read without unescaping, so line breaks and
+		// quotes can't be written back
+		if strings.ContainsAny(res, "\r\n\"") {
+			return "", 0, fmt.Errorf("line %d: %s: value contains a line break or a quote and cannot be written to .env file", i+1, sm[2])
+		}
+
+		if quoted || strings.ContainsAny(res, " \t#'") {
+			res = `"` + res + `"`
+		}
+
+		lines[i] = sm[1] + sm[2] + sm[3] + res + sm[6]
+		count++
+	}
+
+	return strings.Join(lines, "\n"), count, nil
+}
+
+// rewriteToml applies transform to single-line string values of TOML file.
+// Keys are passed to transform as dotted path including the table name,
+// for example "server.password". Lines inside multi-line strings, arrays
+// and inline tables are left intact.
+func rewriteToml(data string, transform transformFunc) (string, int, error) {
+	// Keys of the document are used to check that lines are parsed right
+	var doc map[string]any
+	md, err := toml.Decode(data, &doc)
+	if err != nil {
+		return "", 0, err
+	}
+
+	defined := map[string]bool{}
+	for _, k := range md.Keys() {
+		defined[strings.Join(k, "\x00")] = true
+	}
+
+	lines := strings.Split(data, "\n")
+	count := 0
+	var table []string
+	var sc tomlScanner
+
+	for i, line := range lines {
+		topLevel := sc.topLevel()
+		sc.scan(line)
+
+		if !topLevel {
+			continue
+		}
+
+		if sm := tomlTableRe.FindStringSubmatch(line); sm != nil {
+			table, err = splitTomlKey(sm[1])
+			if err != nil {
+				return "", 0, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			continue
+		}
+
+		sm := tomlLineRe.FindStringSubmatch(line)
+		if sm == nil {
+			continue
+		}
+
+		path, err := splitTomlKey(sm[2])
+		if err != nil {
+			return "", 0, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		path = append(append([]string{}, table...), path...)
+
+		if !defined[strings.Join(path, "\x00")] {
+			return "", 0, fmt.Errorf("line %d: cannot find key %q in the document", i+1, strings.Join(path, "."))
+		}
+
+		val, err := tomlString(sm[4])
+		if err != nil {
+			return "", 0, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		res, changed, err := transform(strings.Join(path, "."), val)
+		if err != nil {
+			return "", 0, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		if !changed {
+			continue
+		}
+
+		lines[i] = sm[1] + sm[2] + sm[3] + tomlQuote(res) + sm[5]
+		count++
+	}
+
+	return strings.Join(lines, "\n"), count, nil
+}
+
+// splitTomlKey splits dotted TOML key into parts, removing quotes
+func splitTomlKey(key string) ([]string, error) {
+	var parts []string
+	for _, part := range tomlKeyPartRe.FindAllString(key, -1) {
+		if strings.HasPrefix(part, `"`) || strings.HasPrefix(part, "'") {
+			var err error
+			part, err = tomlString(part)
+			if err != nil {
+				return nil, err
+			}
+		}
+		parts = append(parts, part)
+	}
+
+	return parts, nil
+}
+
+// tomlString decodes TOML string
+func tomlString(s string) (string, error) {
+	var v struct{ V string }
+	if _, err := toml.Decode("V = "+s, &v); err != nil {
+		return "", err
+	}
+	return v.V, nil
+}
+
+// tomlScanner tracks multi-line strings, arrays and inline tables,
+// so their lines are not taken for keys and tables
+type tomlScanner struct {
+	multiline string // delimiter of the multi-line string
+	depth     int    // nesting of arrays and inline tables
+}
+
+// topLevel reports whether the next line starts outside of multi-line
+// values
+func (sc *tomlScanner) topLevel() bool {
+	return sc.multiline == "" && sc.depth == 0
+}
+
+// scan updates the state with the line
+func (sc *tomlScanner) scan(line string) {
+	for i := 0; i < len(line); i++ {
+		if sc.multiline != "" {
+			if sc.multiline == `"""` && line[i] == '\\' {
+				i++
+			} else if strings.HasPrefix(line[i:], sc.multiline) {
+				i += len(sc.multiline) - 1
+				sc.multiline = ""
+			}
+			continue
+		}
+
+		switch c := line[i]; c {
+		case '#':
+			return
+		case '"', '\'':
+			delim := strings.Repeat(string(c), 3)
+			if strings.HasPrefix(line[i:], delim) {
+				sc.multiline = delim
+				i += len(delim) - 1
+				continue
+			}
+
+			// Single-line string ends on the same line
+			for i++; i < len(line) && line[i] != c; i++ {
+				if c == '"' && line[i] == '\\' {
+					i++
+				}
+			}
+		case '[', '{':
+			sc.depth++
+		case ']', '}':
+			sc.depth--
+		}
+	}
+}
+
+// tomlQuote returns value as TOML basic string
+func tomlQuote(s string) string {
+	var b strings.Builder
+
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
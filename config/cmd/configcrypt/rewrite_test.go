@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fednep/goapilib/config"
+)
+
+func upperKeys(keys ...string) transformFunc {
+	return func(key, val string) (string, bool, error) {
+		for _, k := range keys {
+			if k == key {
+				return strings.ToUpper(val), true, nil
+			}
+		}
+		return val, false, nil
+	}
+}
+
+func TestRewriteToml(t *testing.T) {
+	data := `# comment
+password = "secret" # trailing comment
+name = 'service'
+
+[server]
+password = "server \"secret\""
+port = 8080
+`
+
+	res, count, err := rewriteToml(data, upperKeys("password", "server.password"))
+	if err != nil {
+		t.Fatalf("rewriteToml returned error: %s", err)
+	}
+
+	expected := `# comment
+password = "SECRET" # trailing comment
+name = 'service'
+
+[server]
+password = "SERVER \"SECRET\""
+port = 8080
+`
+
+	if count != 2 || res != expected {
+		t.Fatalf("Unexpected result (%d changes):\n%s", count, res)
+	}
+}
+
+func TestRewriteTomlMultiline(t *testing.T) {
+	data := `db.password = "secret"
+"api.v1".token = 'token'
+ports = [
+  [8080, 8081]
+]
+password = [
+  "not a table",
+]
+description = """
+password = "not a key"
+"""
+
+[server]
+tls = { password = "inline" }
+password = "server"
+
+[[users]]
+password = "user"
+`
+
+	res, count, err := rewriteToml(data, upperKeys("db.password", "api.v1.token", "password", "server.password", "users.password"))
+	if err != nil {
+		t.Fatalf("rewriteToml returned error: %s", err)
+	}
+
+	expected := `db.password = "SECRET"
+"api.v1".token = "TOKEN"
+ports = [
+  [8080, 8081]
+]
+password = [
+  "not a table",
+]
+description = """
+password = "not a key"
+"""
+
+[server]
+tls = { password = "inline" }
+password = "SERVER"
+
+[[users]]
+password = "USER"
+`
+
+	if count != 4 || res != expected {
+		t.Fatalf("Unexpected result (%d changes):\n%s", count, res)
+	}
+}
+
+func TestRewriteFileMissingKeys(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "config.toml")
+	data := "password = \"secret\"\nport = 8080\n"
+	if err := os.WriteFile(fn, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	selected := map[string]bool{"password": true, "port": true, "token": true}
+	err := rewriteFile(fn, selected, upperKeys("password"))
+	if err == nil || !strings.Contains(err.Error(), "port, token not found") {
+		t.Fatalf("Expected error for missing keys, got: %v", err)
+	}
+
+	if res, _ := os.ReadFile(fn); string(res) != data {
+		t.Errorf("File is changed after error:\n%s", res)
+	}
+}
+
+func TestRewriteEnv(t *testing.T) {
+	data := "# comment\nDB_PASSWORD=secret\nTOKEN = \"some token\"\nNAME=service\n"
+
+	res, count, err := rewriteEnv(data, upperKeys("DB_PASSWORD", "TOKEN"))
+	if err != nil {
+		t.Fatalf("rewriteEnv returned error: %s", err)
+	}
+
+	expected := "# comment\nDB_PASSWORD=SECRET\nTOKEN = \"SOME TOKEN\"\nNAME=service\n"
+	if count != 2 || res != expected {
+		t.Fatalf("Unexpected result (%d changes):\n%s", count, res)
+	}
+}
+
+func TestRewriteEnvUnsafeValues(t *testing.T) {
+	for _, val := range []string{"line1\nline2", `say "hi"`, "a\rb"} {
+		transform := func(key, _ string) (string, bool, error) {
+			return val, true, nil
+		}
+
+		if _, _, err := rewriteEnv("TOKEN=enc:v1:abc\n", transform); err == nil {
+			t.Errorf("Expected error writing %q", val)
+		}
+	}
+
+	// Values with spaces and backslashes are read back as is
+	data := "TOKEN=enc:v1:abc\n"
+	res, _, err := rewriteEnv(data, func(key, _ string) (string, bool, error) {
+		return ` C:\dir #1 `, true, nil
+	})
+	if err != nil {
+		t.Fatalf("rewriteEnv returned error: %s", err)
+	}
+
+	fn := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(fn, []byte(res), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := config.EnvFileSource(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if val, _ := src.Lookup("TOKEN"); val != ` C:\dir #1 ` {
+		t.Errorf("Value is changed after rewrite: %q", val)
+	}
+}
@@ -0,0 +1,584 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/types"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const configPkg = "github.com/fednep/goapilib/config"
+
+type generator struct {
+	pkg *types.Package
+
+	// prefix of the helper functions, to avoid conflicts between the files
+	// generated for different types in the same package
+	prefix string
+
+	// imports used by the generated code, path -> name
+	imports map[string]string
+
+	// validators holds names of generated validate functions by type,
+	// empty name if validation of the type is a no-op
+	validators map[string]string
+	funcs      bytes.Buffer
+
+	usesDeref bool
+	tmp       int
+
+	// types of the sections being generated, to detect recursion
+	inProgress map[string]bool
+}
+
+func newGenerator(pkg *types.Package) *generator {
+	return &generator{pkg: pkg}
+}
+
+func (g *generator) reset(named *types.Named) {
+	name := named.Obj().Name()
+	g.prefix = strings.ToLower(name[:1]) + name[1:]
+	g.imports = map[string]string{}
+	g.validators = map[string]string{}
+	g.funcs.Reset()
+	g.usesDeref = false
+	g.tmp = 0
+	g.inProgress = map[string]bool{}
+}
+
+// qualifier is used for types in the generated code
+func (g *generator) qualifier(p *types.Package) string {
+	if p == g.pkg {
+		return ""
+	}
+
+	g.imports[p.Path()] = p.Name()
+	return p.Name()
+}
+
+// typeName returns type as written in the generated code
+func (g *generator) typeName(t types.Type) string {
+	return types.TypeString(t, g.qualifier)
+}
+
+// reflectName returns type name as printed by reflect.Type.String()
+func reflectName(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string { return p.Name() })
+}
+
+func (g *generator) use(path string) string {
+	name := path[strings.LastIndex(path, "/")+1:]
+	g.imports[path] = name
+	return name
+}
+
+func (g *generator) generate(named *types.Named) ([]byte, error) {
+	g.reset(named)
+
+	st := named.Underlying().(*types.Struct)
+	typ := named.Obj().Name()
+
+	var body bytes.Buffer
+
+	fmt.Fprintf(&body, "// LoadFromEnv loads %s from the source the same way as config.LoadFrom does\n", typ)
+	fmt.Fprintf(&body, "func (cfg *%s) LoadFromEnv(src %s.Source) error {\n", typ, g.use(configPkg))
+	if err := g.fillStruct(&body, st, "cfg", ""); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&body, "return nil\n}\n\n")
+
+	validator := g.validator(named)
+	fmt.Fprintf(&body, "// Validate validates %s the same way as config.IsValid does\n", typ)
+	fmt.Fprintf(&body, "func (cfg %s) Validate() error {\n", typ)
+	if validator == "" {
+		fmt.Fprintf(&body, "return nil\n}\n\n")
+	} else {
+		fmt.Fprintf(&body, "return %s(cfg)\n}\n\n", validator)
+	}
+
+	var docs bytes.Buffer
+	if err := g.describeStruct(&docs, st, "cfg", "", "", "", true); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(&body, "// Docs describes fields of %s the same way as config.Docs does\n", typ)
+	fmt.Fprintf(&body, "func (cfg %s) Docs() []config.FieldDoc {\n", typ)
+	if docs.Len() == 0 {
+		fmt.Fprintf(&body, "return nil\n}\n")
+	} else {
+		fmt.Fprintf(&body, "return []config.FieldDoc{\n%s}\n}\n", docs.Bytes())
+	}
+
+	body.Write(g.funcs.Bytes())
+
+	if g.usesDeref {
+		fmt.Fprintf(&body, "\nfunc %sDeref[T any](p *T) T {\nif p == nil {\nvar zero T\nreturn zero\n}\nreturn *p\n}\n", g.prefix)
+	}
+
+	return g.file(typ, body.Bytes(), ""), nil
+}
+
+// file returns source of the generated file with imports
+func (g *generator) file(typ string, body []byte, buildFlags string) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// Code generated by configgen -type %s%s; DO NOT EDIT.\n\n", typ, buildFlags)
+	fmt.Fprintf(&buf, "package %s\n\n", g.pkg.Name())
+
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	// Standard library packages go first, as goimports groups them
+	sort.SliceStable(paths, func(i, j int) bool {
+		return isStd(paths[i]) && !isStd(paths[j])
+	})
+
+	if len(paths) > 0 {
+		fmt.Fprintf(&buf, "import (\n")
+		for i, path := range paths {
+			if i > 0 && isStd(paths[i-1]) != isStd(path) {
+				fmt.Fprintf(&buf, "\n")
+			}
+
+			name := g.imports[path]
+			if name == path[strings.LastIndex(path, "/")+1:] {
+				fmt.Fprintf(&buf, "%q\n", path)
+			} else {
+				fmt.Fprintf(&buf, "%s %q\n", name, path)
+			}
+		}
+		fmt.Fprintf(&buf, ")\n\n")
+	}
+
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func isStd(path string) bool {
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
+
+// fillStruct generates code loading fields of the struct, following
+// fillStructFromEnv
+func (g *generator) fillStruct(w *bytes.Buffer, st *types.Struct, expr string, prefix string) error {
+
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		rawTag := reflect.StructTag(st.Tag(i)).Get("env")
+		tag, opts := parseTag(rawTag)
+
+		ft := f.Type()
+		_, isStruct := ft.Underlying().(*types.Struct)
+
+		// Ignore non-struct fields without tag
+		if tag == "" && !isStruct {
+			continue
+		}
+
+		if prefix != "" {
+			tag = prefix + "_" + tag
+		}
+
+		fexpr := expr + "." + f.Name()
+		fieldError := fmt.Sprintf("config.FieldError{FieldName: %q, Message: err.Error()}", f.Name())
+
+		if opts.Has("prefix") {
+			fmt.Fprintf(w, "if err := config.FillPrefixMap(src, &%s, %q, %q); err != nil {\nreturn %s\n}\n",
+				fexpr, tag, rawTag, fieldError)
+			continue
+		}
+
+		decoder := opts["decoder"]
+		hasAlts := (opts.Has("alias") || opts.Has("deprecated")) && !isStruct
+
+		if decoder == "" && isStruct && !isTextUnmarshaler(ft) {
+			if err := g.enter(ft); err != nil {
+				return err
+			}
+			if err := g.fillStruct(w, ft.Underlying().(*types.Struct), fexpr, tag); err != nil {
+				return err
+			}
+			g.leave(ft)
+			continue
+		}
+
+		if ptr, ok := ft.(*types.Pointer); ok && decoder == "" && isSection(ptr.Elem()) {
+			// Name of the section can be resolved only at runtime
+			if hasAlts {
+				return fmt.Errorf("field %s: alias and deprecated options are not supported for pointers to structs", f.Name())
+			}
+
+			if err := g.enter(ptr.Elem()); err != nil {
+				return err
+			}
+
+			g.tmp++
+			p := fmt.Sprintf("p%d", g.tmp)
+
+			fmt.Fprintf(w, "if _, ok := src.Lookup(%q); ok && %s == nil {\n", tag, fexpr)
+			fmt.Fprintf(w, "%s := new(%s)\n", p, g.typeName(ptr.Elem()))
+			if err := g.fillStruct(w, ptr.Elem().Underlying().(*types.Struct), p, tag); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s = %s\n}\n", fexpr, p)
+
+			g.leave(ptr.Elem())
+			continue
+		}
+
+		if hasAlts {
+			fmt.Fprintf(w, "if name, v, ok, err := config.LookupTag(src, %q, %q); err != nil {\nreturn %s\n} else if ok {\n%s}\n",
+				prefix, rawTag, fieldError, g.fillValue(fexpr, ft, decoder, "name"))
+			continue
+		}
+
+		fmt.Fprintf(w, "if v, ok := src.Lookup(%q); ok {\n%s}\n", tag, g.fillValue(fexpr, ft, decoder, strconv.Quote(tag)))
+	}
+
+	return nil
+}
+
+// fillValue generates code setting expr from string v, following fillValue.
+// name is the expression holding the name of the variable.
+func (g *generator) fillValue(expr string, t types.Type, decoder string, name string) string {
+	if decoder == "" {
+		if isTextUnmarshaler(t) {
+			return g.registered("&"+expr, name, fmt.Sprintf("if err := %s.UnmarshalText([]byte(v)); err != nil {\nreturn %s\n}\n",
+				expr, g.decodeError(name)))
+		}
+
+		if code, ok := g.parseBasic(expr, t); ok {
+			return g.registered("&"+expr, name, code)
+		}
+
+		if ptr, ok := t.(*types.Pointer); ok {
+			elem := ptr.Elem()
+
+			g.tmp++
+			p := fmt.Sprintf("p%d", g.tmp)
+
+			var code string
+			if isTextUnmarshaler(elem) {
+				code = fmt.Sprintf("if err := %s.UnmarshalText([]byte(v)); err != nil {\nreturn %s\n}\n", p, g.decodeError(name))
+			} else if basic, ok := g.parseBasic("*"+p, elem); ok {
+				code = basic
+			}
+
+			// Pointer is set only if it's nil, as by fillValue
+			if code != "" {
+				return g.registered("&"+expr, name, fmt.Sprintf("if %s == nil {\n%s := new(%s)\n%s%s = %s\n}\n",
+					expr, p, g.typeName(elem), g.registered(p, name, code), expr, p))
+			}
+		}
+	}
+
+	// Named decoders and the other types are handled by the config
+	// package, with reflection
+	return fmt.Sprintf("if err := config.DecodeValue(&%s, %s, v, %q); err != nil {\nreturn err\n}\n",
+		expr, name, decoder)
+}
+
+// registered wraps code decoding v, so decoders registered for the type
+// ptr points to take precedence, as in fillValue. Registered decoders are
+// known only at run time.
+func (g *generator) registered(ptr string, name string, code string) string {
+	return fmt.Sprintf("if ok, err := config.DecodeRegistered(%s, %s, v); err != nil {\nreturn err\n} else if !ok {\n%s}\n",
+		ptr, name, code)
+}
+
+func (g *generator) decodeError(name string) string {
+	return fmt.Sprintf(`%s.Errorf("cannot decode %%q: %%w", %s, err)`, g.use("fmt"), name)
+}
+
+// parseBasic generates code parsing v into expr of a predeclared type,
+// values which cannot be parsed are ignored as by setValue
+func (g *generator) parseBasic(expr string, t types.Type) (string, bool) {
+	b, ok := t.(*types.Basic)
+	if !ok {
+		return "", false
+	}
+
+	name := b.Name()
+	conv := func(v string) string {
+		switch name {
+		case "int64", "uint64", "float64":
+			return v
+		}
+		return name + "(" + v + ")"
+	}
+
+	switch b.Kind() {
+	case types.String:
+		return fmt.Sprintf("%s = v\n", expr), true
+
+	case types.Bool:
+		return fmt.Sprintf("switch %s.ToLower(v) {\ncase \"false\", \"0\":\n%s = false\ncase \"true\", \"1\":\n%s = true\n}\n",
+			g.use("strings"), expr, expr), true
+
+	case types.Int, types.Int8, types.Int16, types.Int32, types.Int64:
+		return fmt.Sprintf("if n, err := %s.ParseInt(v, 10, 64); err == nil {\n%s = %s\n}\n",
+			g.use("strconv"), expr, conv("n")), true
+
+	case types.Uint, types.Uint8, types.Uint16, types.Uint32, types.Uint64:
+		return fmt.Sprintf("if n, err := %s.ParseUint(v, 10, 64); err == nil {\n%s = %s\n}\n",
+			g.use("strconv"), expr, conv("n")), true
+
+	case types.Float32, types.Float64:
+		return fmt.Sprintf("if n, err := %s.ParseFloat(v, 64); err == nil {\n%s = %s\n}\n",
+			g.use("strconv"), expr, conv("n")), true
+	}
+
+	return "", false
+}
+
+func (g *generator) enter(t types.Type) error {
+	key := types.TypeString(t, nil)
+	if g.inProgress[key] {
+		return fmt.Errorf("recursive type %s is not supported", reflectName(t))
+	}
+
+	g.inProgress[key] = true
+	return nil
+}
+
+func (g *generator) leave(t types.Type) {
+	delete(g.inProgress, types.TypeString(t, nil))
+}
+
+// validator generates function validating struct of type t, following
+// validate. Returns empty string if there is nothing to validate.
+func (g *generator) validator(t types.Type) string {
+	key := types.TypeString(t, nil)
+	if name, ok := g.validators[key]; ok {
+		return name
+	}
+
+	st := t.Underlying().(*types.Struct)
+
+	var body bytes.Buffer
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+
+		// Unexported sections cannot be validated by IsValid either
+		if !f.Exported() {
+			continue
+		}
+
+		if _, ok := f.Type().Underlying().(*types.Struct); !ok {
+			continue
+		}
+
+		name := g.validator(f.Type())
+		if name == "" {
+			continue
+		}
+
+		fmt.Fprintf(&body, "if err := %s(st.%s); err != nil {\nreturn config.SectionError{Section: %q, Err: err}\n}\n",
+			name, f.Name(), f.Name())
+	}
+
+	section := implementsSection(t)
+	if body.Len() == 0 && !section {
+		g.validators[key] = ""
+		return ""
+	}
+
+	name := g.prefix + "Validate" + g.validatorSuffix(t, len(g.validators))
+	g.validators[key] = name
+
+	fmt.Fprintf(&g.funcs, "\nfunc %s(st %s) error {\n%s", name, g.typeName(t), body.Bytes())
+	if section {
+		fmt.Fprintf(&g.funcs, "return st.IsValid()\n}\n")
+	} else {
+		fmt.Fprintf(&g.funcs, "return nil\n}\n")
+	}
+
+	return name
+}
+
+func (g *generator) validatorSuffix(t types.Type, n int) string {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return fmt.Sprintf("Struct%d", n)
+	}
+
+	name := strings.ToUpper(named.Obj().Name()[:1]) + named.Obj().Name()[1:]
+	if pkg := named.Obj().Pkg(); pkg != nil && pkg != g.pkg {
+		name = strings.ToUpper(pkg.Name()[:1]) + pkg.Name()[1:] + name
+	}
+	return name
+}
+
+// describeStruct generates FieldDoc literals, following describeStruct
+// of the config package
+func (g *generator) describeStruct(w *bytes.Buffer, st *types.Struct, expr, path, envPrefix, tomlPath string, hasEnv bool) error {
+
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		if !f.Exported() {
+			continue
+		}
+
+		tags := reflect.StructTag(st.Tag(i))
+		envName, envOpts := parseTag(tags.Get("env"))
+		tomlName, _ := parseTag(tags.Get("toml"))
+		if tomlName == "" {
+			tomlName = f.Name()
+		}
+
+		ft := f.Type()
+		fexpr := expr + "." + f.Name()
+		ptr, isPtr := ft.(*types.Pointer)
+		if isPtr {
+			ft = ptr.Elem()
+			fexpr = g.prefix + "Deref(" + fexpr + ")"
+			g.usesDeref = true
+		}
+
+		env := ""
+		if hasEnv && envName != "" {
+			env = envName
+			if envPrefix != "" {
+				env = envPrefix + "_" + envName
+			}
+		}
+
+		if isSection(ft) {
+			sectionEnv := envName
+			if envPrefix != "" {
+				sectionEnv = envPrefix + "_" + envName
+			}
+			sectionHasEnv := hasEnv && (!isPtr || envName != "")
+
+			sectionToml := joinPath(tomlPath, tomlName)
+			if f.Anonymous() && tags.Get("toml") == "" {
+				sectionToml = tomlPath
+			}
+
+			if tomlName == "-" {
+				sectionToml = "-"
+			}
+
+			if err := g.enter(ft); err != nil {
+				return err
+			}
+			err := g.describeStruct(w, ft.Underlying().(*types.Struct), fexpr, joinPath(path, f.Name()),
+				sectionEnv, sectionToml, sectionHasEnv)
+			if err != nil {
+				return err
+			}
+			g.leave(ft)
+			continue
+		}
+
+		if envOpts.Has("prefix") && env != "" {
+			env += "_*"
+		}
+
+		toml := ""
+		if tomlName != "-" && tomlPath != "-" {
+			toml = joinPath(tomlPath, tomlName)
+		}
+
+		secret := tags.Get("secret") == "true"
+		def := "config.DocDefault(" + fexpr + ")"
+		if secret {
+			def = "config.Mask"
+		}
+
+		fmt.Fprintf(w, "{\nPath: %q,\n", joinPath(path, f.Name()))
+		if env != "" {
+			fmt.Fprintf(w, "Env: %q,\n", env)
+		}
+		if toml != "" {
+			fmt.Fprintf(w, "Toml: %q,\n", toml)
+		}
+		fmt.Fprintf(w, "Type: %q,\nDefault: %s,\n", reflectName(ft), def)
+		if desc := tags.Get("desc"); desc != "" {
+			fmt.Fprintf(w, "Description: %q,\n", desc)
+		}
+		if secret {
+			fmt.Fprintf(w, "Secret: true,\n")
+		}
+		fmt.Fprintf(w, "},\n")
+	}
+
+	return nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+var (
+	errorType = types.Universe.Lookup("error").Type()
+
+	textUnmarshaler = types.NewInterfaceType([]*types.Func{
+		types.NewFunc(0, nil, "UnmarshalText", types.NewSignatureType(nil, nil, nil,
+			types.NewTuple(types.NewVar(0, nil, "text", types.NewSlice(types.Typ[types.Byte]))),
+			types.NewTuple(types.NewVar(0, nil, "", errorType)), false)),
+	}, nil).Complete()
+
+	sectionInterface = types.NewInterfaceType([]*types.Func{
+		types.NewFunc(0, nil, "IsValid", types.NewSignatureType(nil, nil, nil, nil,
+			types.NewTuple(types.NewVar(0, nil, "", errorType)), false)),
+	}, nil).Complete()
+)
+
+// isTextUnmarshaler reports whether non-pointer type implements
+// encoding.TextUnmarshaler with a pointer receiver
+func isTextUnmarshaler(t types.Type) bool {
+	if _, ok := t.(*types.Pointer); ok {
+		return false
+	}
+
+	return types.Implements(types.NewPointer(t), textUnmarshaler)
+}
+
+// isSection reports whether t is a struct which is loaded field by field
+func isSection(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Struct)
+	return ok && !isTextUnmarshaler(t)
+}
+
+func implementsSection(t types.Type) bool {
+	return types.Implements(t, sectionInterface)
+}
+
+// parseTag splits struct tag into the name and options,
+// the same way as the config package does
+func parseTag(tag string) (string, tagOptions) {
+	name, rest, found := strings.Cut(tag, ",")
+	if !found {
+		return name, nil
+	}
+
+	opts := tagOptions{}
+	for _, opt := range strings.Split(rest, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+
+		key, value, _ := strings.Cut(opt, "=")
+		opts[key] = value
+	}
+
+	return name, opts
+}
+
+type tagOptions map[string]string
+
+func (o tagOptions) Has(name string) bool {
+	_, ok := o[name]
+	return ok
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/types"
+	"reflect"
+	"sort"
+)
+
+// generateTest generates test which loads sample values with both
+// generated and reflective loaders and compares the results, as well as
+// the results of validation and documentation
+func (g *generator) generateTest(named *types.Named) ([]byte, error) {
+	g.reset(named)
+
+	typ := named.Obj().Name()
+	samples := map[string]string{}
+	g.samples(named.Underlying().(*types.Struct), "", samples)
+
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	g.use("fmt")
+	g.use("reflect")
+	g.use("testing")
+	g.use(configPkg)
+
+	var body bytes.Buffer
+
+	fmt.Fprintf(&body, "func Test%sGenerated(t *testing.T) {\n", typ)
+	fmt.Fprintf(&body, "src := config.MapSource{\n")
+	for _, name := range names {
+		fmt.Fprintf(&body, "%q: %q,\n", name, samples[name])
+	}
+	fmt.Fprintf(&body, "}\n\n")
+
+	fmt.Fprintf(&body, `var want, got %s
+if err := config.LoadFrom(&want, src); err != nil {
+	t.Fatalf("LoadFrom: %%s", err)
+}
+
+if err := got.LoadFromEnv(src); err != nil {
+	t.Fatalf("LoadFromEnv: %%s", err)
+}
+
+if !reflect.DeepEqual(want, got) {
+	changes, _ := config.Diff(want, got)
+	t.Fatalf("LoadFromEnv differs from LoadFrom: %%v", changes)
+}
+
+for _, cfg := range []%s{{}, want} {
+	err, genErr := config.IsValid(cfg), cfg.Validate()
+	if fmt.Sprint(genErr) != fmt.Sprint(err) || config.FieldPath(genErr) != config.FieldPath(err) {
+		t.Errorf("Validate() = %%v, IsValid() = %%v", genErr, err)
+	}
+
+	docs, err := config.Docs(cfg)
+	if err != nil {
+		t.Fatalf("Docs: %%s", err)
+	}
+
+	if genDocs := cfg.Docs(); !reflect.DeepEqual(genDocs, docs) {
+		t.Errorf("Docs() = %%+v, want %%+v", genDocs, docs)
+	}
+}
+}
+`, typ, typ)
+
+	return g.file(typ, body.Bytes(), " -test"), nil
+}
+
+// samples collects names of the variables with sample values for the
+// fields of supported types, following fillStructFromEnv
+func (g *generator) samples(st *types.Struct, prefix string, samples map[string]string) {
+
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		if !f.Exported() {
+			continue
+		}
+
+		tag, opts := parseTag(reflect.StructTag(st.Tag(i)).Get("env"))
+
+		ft := f.Type()
+		_, isStruct := ft.Underlying().(*types.Struct)
+		if tag == "" && !isStruct {
+			continue
+		}
+
+		if prefix != "" {
+			tag = prefix + "_" + tag
+		}
+
+		if opts.Has("decoder") {
+			continue
+		}
+
+		if opts.Has("prefix") {
+			if m, ok := ft.Underlying().(*types.Map); ok {
+				if val, ok := sampleValue(m.Elem(), len(samples)); ok {
+					samples[tag+"_sample"] = val
+				}
+			}
+			continue
+		}
+
+		if isSection(ft) {
+			g.samples(ft.Underlying().(*types.Struct), tag, samples)
+			continue
+		}
+
+		if ptr, ok := ft.(*types.Pointer); ok {
+			ft = ptr.Elem()
+			if isSection(ft) {
+				if g.enter(ft) != nil {
+					continue
+				}
+				samples[tag] = "1"
+				g.samples(ft.Underlying().(*types.Struct), tag, samples)
+				g.leave(ft)
+				continue
+			}
+		}
+
+		if val, ok := sampleValue(ft, len(samples)); ok {
+			samples[tag] = val
+		}
+	}
+}
+
+func sampleValue(t types.Type, n int) (string, bool) {
+	n = n%100 + 1
+
+	switch types.TypeString(t, nil) {
+	case configPkg + ".Duration":
+		return "90s", true
+	case configPkg + ".ByteSize":
+		return "10MiB", true
+	case configPkg + ".Percent":
+		return "5%", true
+	}
+
+	b, ok := t.(*types.Basic)
+	if !ok {
+		return "", false
+	}
+
+	switch {
+	case b.Info()&types.IsString != 0:
+		return fmt.Sprintf("sample-%d", n), true
+	case b.Info()&types.IsBoolean != 0:
+		return "true", true
+	case b.Info()&types.IsInteger != 0:
+		return fmt.Sprint(n), true
+	case b.Info()&types.IsFloat != 0:
+		return fmt.Sprintf("%d.5", n), true
+	}
+
+	return "", false
+}
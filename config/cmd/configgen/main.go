@@ -0,0 +1,177 @@
+// Command configgen generates reflection-free implementation of loading,
+// validation and documentation for a configuration struct, with the same
+// semantics as config.LoadFrom, config.IsValid and config.Docs.
+//
+// Usage with go generate:
+//
+//	//go:generate go run github.com/fednep/goapilib/config/cmd/configgen -type Config -test
+//
+// For the Config type the following methods are generated:
+//
+//	func (cfg *Config) LoadFromEnv(src config.Source) error
+//	func (cfg Config) Validate() error
+//	func (cfg Config) Docs() []config.FieldDoc
+//
+// With -test flag, a test asserting that generated and reflective
+// implementations agree is generated as well.
+//
+// Values of the predeclared types, encoding.TextUnmarshaler implementations
+// and nested sections are parsed without reflection. Decoders registered
+// with config.RegisterDecoder are known only at run time, so they are
+// still looked up for every field, and take precedence over parsing as in
+// config.LoadFrom. Fields with "decoder" tag option and the values of
+// other types are decoded by the config package.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeName := flag.String("type", "", "Name of the configuration struct type (required)")
+	output := flag.String("output", "", "Output file name (default: <type>_gen.go)")
+	dir := flag.String("dir", ".", "Directory of the package with the type")
+	withTest := flag.Bool("test", false, "Generate test asserting that generated and reflective loaders agree")
+	flag.Parse()
+
+	if *typeName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *output == "" {
+		*output = strings.ToLower(*typeName) + "_gen.go"
+	}
+
+	if err := run(*dir, *typeName, *output, *withTest); err != nil {
+		log.Fatalf("configgen: %s", err)
+	}
+}
+
+func run(dir, typeName, output string, withTest bool) error {
+	files, err := generateFiles(dir, typeName, output, withTest)
+	if err != nil {
+		return err
+	}
+
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), src, 0o644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// generateFiles returns formatted sources of the generated files by names
+func generateFiles(dir, typeName, output string, withTest bool) (map[string][]byte, error) {
+	pkg, err := loadPackage(dir, output)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := pkg.Scope().Lookup(typeName)
+	if obj == nil {
+		return nil, fmt.Errorf("type %q is not found in %s", typeName, dir)
+	}
+
+	named, ok := obj.Type().(*types.Named)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a named type", typeName)
+	}
+
+	if _, ok := named.Underlying().(*types.Struct); !ok {
+		return nil, fmt.Errorf("%q is not a struct", typeName)
+	}
+
+	g := newGenerator(pkg)
+	files := map[string][]byte{}
+
+	src, err := g.generate(named)
+	if err != nil {
+		return nil, err
+	}
+
+	if files[output], err = formatSource(src); err != nil {
+		return nil, err
+	}
+
+	if withTest {
+		src, err := g.generateTest(named)
+		if err != nil {
+			return nil, err
+		}
+
+		testFile := strings.TrimSuffix(output, ".go") + "_test.go"
+		if files[testFile], err = formatSource(src); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// Imported packages are type-checked from source once, and shared by
+// the packages loaded by the process
+var (
+	fset           = token.NewFileSet()
+	sourceImporter = importer.ForCompiler(fset, "source", nil)
+)
+
+// loadPackage parses and type-checks the package in dir, skipping tests
+// and the previously generated output
+func loadPackage(dir, output string) (*types.Package, error) {
+	skip := map[string]bool{
+		output: true,
+		strings.TrimSuffix(output, ".go") + "_test.go": true,
+	}
+
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !skip[fi.Name()] && !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected one package in %s, found %d", dir, len(pkgs))
+	}
+
+	var name string
+	var files []*ast.File
+	for n, p := range pkgs {
+		name = n
+		for _, f := range p.Files {
+			files = append(files, f)
+		}
+	}
+
+	conf := types.Config{Importer: sourceImporter}
+	pkg, err := conf.Check(name, fset, files, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot type-check package: %w", err)
+	}
+
+	return pkg, nil
+}
+
+func formatSource(src []byte) ([]byte, error) {
+	formatted, err := format.Source(src)
+	if err != nil {
+		return nil, errors.New("cannot format generated code: " + err.Error() + "\n" + string(src))
+	}
+
+	return formatted, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// typeCheck type-checks the package in dir together with the generated files
+func typeCheck(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return files[fi.Name()] == nil
+	}, 0)
+	if err != nil {
+		t.Fatalf("Cannot parse %s: %s", dir, err)
+	}
+
+	var parsed []*ast.File
+	for _, p := range pkgs {
+		for _, f := range p.Files {
+			parsed = append(parsed, f)
+		}
+	}
+
+	for name, src := range files {
+		f, err := parser.ParseFile(fset, name, src, 0)
+		if err != nil {
+			t.Fatalf("Cannot parse generated %s: %s", name, err)
+		}
+		parsed = append(parsed, f)
+	}
+
+	conf := types.Config{Importer: sourceImporter}
+	if _, err := conf.Check("sample", fset, parsed, nil); err != nil {
+		t.Fatalf("Generated code doesn't compile: %s", err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	files, err := generateFiles("testdata/sample", "Config", "config_gen.go", true)
+	if err != nil {
+		t.Fatalf("Generation failed: %s", err)
+	}
+
+	gen := string(files["config_gen.go"])
+	if !strings.HasPrefix(gen, "// Code generated by configgen -type Config; DO NOT EDIT.") {
+		t.Errorf("Generated code has no header:\n%s", gen)
+	}
+
+	// Decoders registered for Ratio (float32) are checked at run time
+	if !strings.Contains(gen, "config.DecodeRegistered(&cfg.Ratio, ") {
+		t.Errorf("Generated code doesn't look up registered decoders:\n%s", gen)
+	}
+
+	typeCheck(t, "testdata/sample", files)
+}
+
+// TestGeneratedExample checks that the generated code of the example is
+// up to date, so its generated test checks the current generator
+func TestGeneratedExample(t *testing.T) {
+	dir := "../../examples/server"
+
+	files, err := generateFiles(dir, "Config", "config_gen.go", true)
+	if err != nil {
+		t.Fatalf("Generation failed: %s", err)
+	}
+
+	for name, src := range files {
+		committed, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Cannot read %s: %s", name, err)
+		}
+
+		if !bytes.Equal(committed, src) {
+			t.Errorf("%s is outdated, run go generate in %s", name, dir)
+		}
+	}
+}
+
+// TestGenerateRun runs tests generated for the sample, which compare
+// generated and reflective loaders. It builds a separate test binary,
+// so it's enabled only with CONFIGGEN_RUN=1.
+func TestGenerateRun(t *testing.T) {
+	if os.Getenv("CONFIGGEN_RUN") == "" {
+		t.Skip("set CONFIGGEN_RUN=1 to run go test on the generated code")
+	}
+
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool is not available")
+	}
+
+	// Generated package should be inside the module to import config
+	dir, err := os.MkdirTemp("testdata", "gen-")
+	if err != nil {
+		t.Fatalf("Cannot create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := os.ReadFile("testdata/sample/sample.go")
+	if err != nil {
+		t.Fatalf("Cannot read sample: %s", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "sample.go"), src, 0o644); err != nil {
+		t.Fatalf("Cannot write sample: %s", err)
+	}
+
+	if err := run(dir, "Config", "config_gen.go", true); err != nil {
+		t.Fatalf("Generation failed: %s", err)
+	}
+
+	cmd := exec.Command(goTool, "test", "-count=1", ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Generated test failed: %s\n%s", err, out)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		typeName string
+		err      string
+	}{
+		{"Missing", `type "Missing" is not found`},
+		{"Level", `"Level" is not a struct`},
+	}
+
+	for _, tt := range tests {
+		_, err := generateFiles("testdata/sample", tt.typeName, "out_gen.go", false)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("generateFiles(%s) = %v, want %q", tt.typeName, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package sample
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/fednep/goapilib/config"
+)
+
+func init() {
+	config.RegisterNamedDecoder("csv", func(s string) (any, error) {
+		return strings.Split(s, ","), nil
+	})
+
+	// Generated code has to honour decoders registered for the
+	// predeclared types as well
+	config.RegisterDecoder(reflect.TypeOf(float32(0)), func(s string) (any, error) {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 32)
+		return float32(f / 100), err
+	})
+}
+
+type Level string
+
+type Config struct {
+	Name     string            `env:"NAME" desc:"Service name"`
+	Port     int               `env:"PORT,alias=HTTP_PORT" toml:"port"`
+	Ratio    float32           `env:"RATIO"`
+	Debug    bool              `env:"DEBUG"`
+	Workers  *uint8            `env:"WORKERS"`
+	Timeout  config.Duration   `env:"TIMEOUT"`
+	MaxBody  *config.ByteSize  `env:"MAX_BODY"`
+	Password string            `env:"PASSWORD" secret:"true"`
+	Labels   map[string]string `env:"LABELS,prefix,case=lower"`
+	Hosts    []string          `env:"HOSTS,decoder=csv"`
+	Level    Level             `env:"LEVEL"`
+	Internal string            `toml:"-"`
+
+	DB    Database `env:"DB" toml:"database"`
+	Cache *Cache   `env:"CACHE"`
+
+	Limits
+
+	ignored string
+}
+
+type Database struct {
+	URL  string `env:"URL"`
+	Pool uint16 `env:"POOL"`
+}
+
+func (db Database) IsValid() error {
+	if db.URL == "" {
+		return config.FieldError{FieldName: "URL", Message: "not configured"}
+	}
+	return nil
+}
+
+type Cache struct {
+	Size config.ByteSize  `env:"SIZE"`
+	TTL  *config.Duration `env:"TTL"`
+}
+
+type Limits struct {
+	Rate config.Percent `env:"RATE"`
+}
+
+func (l Limits) IsValid() error {
+	if l.Rate > 1 {
+		return errors.New("rate is above 100%")
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Names of the files in DevTLSCacheDir
+const (
+	DevCAFile     = "ca.pem"
+	DevCAKeyFile  = "ca-key.pem"
+	DevCertFile   = "cert.pem"
+	DevKeyFile    = "key.pem"
+	devCAValidity = 365 * 24 * time.Hour
+	devValidity   = 30 * 24 * time.Hour
+)
+
+// CertLoader returns loader of the server certificate. In development mode
+// (see DevTLS) certificates are generated, otherwise they are loaded from
+// CertFile and KeyFile.
+func (cfg ServerConfig) CertLoader() (*CertLoader, error) {
+	if !cfg.DevTLS {
+		return NewCertLoader(cfg.CertFile, cfg.KeyFile)
+	}
+
+	dir := cfg.DevTLSCacheDir
+	if dir == "" {
+		var err error
+		dir, err = defaultDevTLSDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := generateDevCert(devHosts(cfg.host()), dir, cfg.DevTLSCacheDir != "")
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate development certificate: %w", err)
+	}
+
+	log.Printf("Development TLS certificate is self-signed, trust CA from: %s", filepath.Join(dir, DevCAFile))
+
+	if cfg.DevTLSCacheDir == "" {
+		// Keys stay in memory, only CA certificate is written
+		return newStaticCertLoader(cert), nil
+	}
+
+	return NewCertLoader(filepath.Join(dir, DevCertFile), filepath.Join(dir, DevKeyFile))
+}
+
+// defaultDevTLSDir returns directory for the CA certificate when
+// DevTLSCacheDir is not set. The directory is the same on each start,
+// so nothing is left behind.
+func defaultDevTLSDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find directory for development certificate, set DevTLSCacheDir: %w", err)
+	}
+
+	return filepath.Join(dir, "goapilib", "devtls"), nil
+}
+
+// devHosts returns names the development certificate is issued for
+func devHosts(address string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+
+	ip := net.ParseIP(address)
+	if address == "" || (ip != nil && ip.IsUnspecified()) {
+		return hosts
+	}
+
+	for _, h := range hosts {
+		if h == address {
+			return hosts
+		}
+	}
+
+	return append(hosts, address)
+}
+
+// generateDevCert issues certificate for the hosts. If persist is set,
+// it is signed by the CA from dir, which is generated if it doesn't exist
+// or expires soon, and keys and the issued certificate are written to dir.
+// Otherwise the CA is generated once per process. CA certificate is
+// always written to dir.
+func generateDevCert(hosts []string, dir string, persist bool) (tls.Certificate, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	var ca *x509.Certificate
+	var caKey *ecdsa.PrivateKey
+	var err error
+
+	if persist {
+		ca, caKey, err = loadDevCA(dir)
+		if err != nil {
+			ca, caKey, err = newDevCA()
+			if err != nil {
+				return tls.Certificate{}, err
+			}
+
+			caKeyDER, err := x509.MarshalECPrivateKey(caKey)
+			if err != nil {
+				return tls.Certificate{}, err
+			}
+
+			if err := writePEM(filepath.Join(dir, DevCAKeyFile), 0o600, "EC PRIVATE KEY", caKeyDER); err != nil {
+				return tls.Certificate{}, err
+			}
+		}
+	} else {
+		// Servers of the process share the CA, so the written CA
+		// certificate verifies all of them
+		processCA.once.Do(func() {
+			processCA.cert, processCA.key, processCA.err = newDevCA()
+		})
+		ca, caKey, err = processCA.cert, processCA.key, processCA.err
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	if err := writePEM(filepath.Join(dir, DevCAFile), 0o644, "CERTIFICATE", ca.Raw); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	leaf, key, err := newDevCert(pkix.Name{CommonName: hosts[0]}, hosts, ca, caKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if persist {
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+
+		if err := writePEM(filepath.Join(dir, DevKeyFile), 0o600, "EC PRIVATE KEY", keyDER); err != nil {
+			return tls.Certificate{}, err
+		}
+
+		if err := writePEM(filepath.Join(dir, DevCertFile), 0o644, "CERTIFICATE", leaf.Raw, ca.Raw); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{leaf.Raw, ca.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// processCA is the CA generated once per process when the CA is not
+// persisted
+var processCA struct {
+	once sync.Once
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	err  error
+}
+
+// newDevCA generates self-signed CA certificate
+func newDevCA() (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	return newDevCert(pkix.Name{CommonName: "goapilib development CA"}, nil, nil, nil)
+}
+
+// loadDevCA loads CA certificate and key from dir, returns error if
+// they don't exist or the CA expires soon
+func loadDevCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	pair, err := tls.LoadX509KeyPair(filepath.Join(dir, DevCAFile), filepath.Join(dir, DevCAKeyFile))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ca, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("unsupported CA key")
+	}
+
+	if time.Until(ca.NotAfter) < devValidity {
+		return nil, nil, errors.New("CA expires soon")
+	}
+
+	return ca, key, nil
+}
+
+// newDevCert generates certificate for the hosts signed by parent,
+// or self-signed CA certificate if parent is nil
+func newDevCert(subject pkix.Name, hosts []string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(devValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.NotAfter = time.Now().Add(devCAValidity)
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		tmpl.ExtKeyUsage = nil
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+// writePEM writes blocks of the same type into the file. The file is
+// replaced atomically, so readers never see it partially written.
+func writePEM(fn string, mode os.FileMode, typ string, blocks ...[]byte) error {
+	var data []byte
+	for _, der := range blocks {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})...)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(fn), filepath.Base(fn)+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), fn)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+
+	return err
+}
@@ -0,0 +1,144 @@
+package common
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDevTLS(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	t.Setenv("HOME", cacheDir)
+	t.Setenv("LocalAppData", cacheDir)
+
+	cfg := ServerConfig{Address: "dev.local", Port: 8443, UseTLS: true, DevTLS: true}
+	if err := cfg.IsValid(); err != nil {
+		t.Fatalf("Dev TLS config without certificates is not valid: %s", err)
+	}
+
+	loader, err := cfg.CertLoader()
+	if err != nil {
+		t.Fatalf("CertLoader returned error: %s", err)
+	}
+
+	cert, _ := loader.GetCertificate(nil)
+	if cert == nil || len(cert.Certificate) != 2 {
+		t.Fatalf("Expected certificate with CA in the chain, got %v", cert)
+	}
+
+	ca, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		t.Fatalf("Cannot parse CA: %s", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	for _, host := range []string{"dev.local", "localhost", "127.0.0.1", "::1"} {
+		if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("Certificate is not valid for %s: %s", host, err)
+		}
+	}
+
+	if loader.NotAfter().IsZero() {
+		t.Errorf("Expected expiry of the generated certificate")
+	}
+
+	// Only CA certificate is written, to the same dir on each start
+	dir, err := defaultDevTLSDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caPEM, err := os.ReadFile(filepath.Join(dir, DevCAFile))
+	if err != nil {
+		t.Fatalf("CA certificate is not written: %s", err)
+	}
+
+	if !bytes.Contains(caPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})) {
+		t.Errorf("Written CA certificate is not the one the certificate is signed with")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, DevKeyFile)); err == nil {
+		t.Errorf("Key of the certificate should not be written")
+	}
+
+	if cfg := (ServerConfig{Port: 8443, DevTLS: true}); cfg.IsValid() == nil {
+		t.Errorf("Expected DevTLS without UseTLS to be invalid")
+	}
+}
+
+func TestDevTLSSharedCA(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	t.Setenv("HOME", cacheDir)
+	t.Setenv("LocalAppData", cacheDir)
+
+	// Servers of a group load certificates one after another
+	cfg := ServerConfig{Port: 8443, UseTLS: true, DevTLS: true}
+	first, err := cfg.CertLoader()
+	if err != nil {
+		t.Fatalf("CertLoader returned error: %s", err)
+	}
+
+	if _, err := (ServerConfig{Port: 8444, UseTLS: true, DevTLS: true}).CertLoader(); err != nil {
+		t.Fatalf("CertLoader returned error: %s", err)
+	}
+
+	dir, err := defaultDevTLSDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caPEM, err := os.ReadFile(filepath.Join(dir, DevCAFile))
+	if err != nil {
+		t.Fatalf("CA certificate is not written: %s", err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		t.Fatalf("Cannot parse %s", DevCAFile)
+	}
+
+	cert, _ := first.GetCertificate(nil)
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "localhost", Roots: roots}); err != nil {
+		t.Errorf("Certificate of the first server is not verified by written CA: %s", err)
+	}
+}
+
+func TestDevTLSCacheDir(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "certs")
+	cfg := ServerConfig{Port: 8443, UseTLS: true, DevTLS: true, DevTLSCacheDir: dir}
+
+	if _, err := cfg.CertLoader(); err != nil {
+		t.Fatalf("CertLoader returned error: %s", err)
+	}
+
+	ca, err := os.ReadFile(filepath.Join(dir, DevCAFile))
+	if err != nil {
+		t.Fatalf("CA is not persisted: %s", err)
+	}
+
+	if fi, err := os.Stat(filepath.Join(dir, DevCAKeyFile)); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("Expected CA key to be readable by owner only: %v, %v", fi, err)
+	}
+
+	loader, err := cfg.CertLoader()
+	if err != nil {
+		t.Fatalf("CertLoader returned error: %s", err)
+	}
+
+	if loader.CertFile != filepath.Join(dir, DevCertFile) {
+		t.Errorf("Expected certificate to be loaded from the cache dir, got %s", loader.CertFile)
+	}
+
+	if again, _ := os.ReadFile(filepath.Join(dir, DevCAFile)); !bytes.Equal(ca, again) {
+		t.Errorf("Expected CA to be reused")
+	}
+}
@@ -1,8 +1,14 @@
 package common
 
 import (
+	"crypto/tls"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/fednep/goapilib/config"
@@ -11,22 +17,278 @@ import (
 // ServerConfig contains common config parameters
 // for configuring HTTP(S) server
 type ServerConfig struct {
+	// Address is a host name or IP address to listen on with Port,
+	// "unix:/path/to/socket" for unix domain socket, or "systemd:" and
+	// "systemd:<name>" for a socket passed by systemd (see Listen)
 	Address  string `env:"HTTP_ADDRESS"`
 	Port     int    `env:"HTTP_PORT"`
 	UseTLS   bool   `env:"HTTP_USE_TLS"`
 	CertFile string `env:"HTTP_CERT_FILE"`
 	KeyFile  string `env:"HTTP_KEY_FILE"`
 
-	Timeout int `env:"HTTP_TIMEOUT"`
+	// SocketMode sets permissions of the unix socket, for example "0660"
+	SocketMode string `env:"HTTP_SOCKET_MODE"`
+
+	// SocketOwner and SocketGroup set ownership of the unix socket,
+	// by name or numeric id
+	SocketOwner string `env:"HTTP_SOCKET_OWNER"`
+	SocketGroup string `env:"HTTP_SOCKET_GROUP"`
+
+	// Timeout can be specified as integer number of seconds or
+	// as a duration string, for example "1m30s". It is used for read,
+	// write, idle and shutdown timeouts which are not set explicitly.
+	//
+	// Timeout used to be int number of seconds. In Go code it is set as
+	// config.Duration(30 * time.Second) now, Timeout: 30 means 30ns and is
+	// rejected by IsValid.
+	Timeout config.Duration `env:"HTTP_TIMEOUT"`
+
+	ReadTimeout config.Duration `env:"HTTP_READ_TIMEOUT"`
+
+	// ReadHeaderTimeout defaults to the read timeout, or to
+	// DefaultReadHeaderTimeout if neither is set
+	ReadHeaderTimeout config.Duration `env:"HTTP_READ_HEADER_TIMEOUT"`
+
+	WriteTimeout config.Duration `env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout  config.Duration `env:"HTTP_IDLE_TIMEOUT"`
+
+	// ShutdownTimeout limits the time given to active requests to
+	// complete when the server is stopped
+	ShutdownTimeout config.Duration `env:"HTTP_SHUTDOWN_TIMEOUT"`
+
+	// MaxHeaderBytes defaults to http.DefaultMaxHeaderBytes
+	MaxHeaderBytes config.ByteSize `env:"HTTP_MAX_HEADER_BYTES"`
+
+	// MaxBodySize limits size of request bodies, unlimited if not set
+	MaxBodySize config.ByteSize `env:"HTTP_MAX_BODY_SIZE"`
+
+	DisableKeepAlives bool `env:"HTTP_DISABLE_KEEP_ALIVES"`
+
+	// TLSMinVersion is one of "1.0", "1.1", "1.2" (default) or "1.3"
+	TLSMinVersion string `env:"HTTP_TLS_MIN_VERSION"`
+
+	// TLSCiphers lists names of cipher suites in order of preference,
+	// for example "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256". Go defaults
+	// are used if not set. Cipher suites of TLS 1.3 are not configurable.
+	TLSCiphers config.List `env:"HTTP_TLS_CIPHERS"`
+
+	// TLSCurves lists elliptic curves for key exchange in order of
+	// preference: "X25519", "P256", "P384" or "P521". Go defaults are
+	// used if not set.
+	TLSCurves config.List `env:"HTTP_TLS_CURVES"`
+
+	// DisableHTTP2 removes HTTP/2 from the protocols negotiated with ALPN
+	DisableHTTP2 bool `env:"HTTP_DISABLE_HTTP2"`
+
+	// DevTLS generates self-signed CA and certificate for Address,
+	// "localhost", "127.0.0.1" and "::1" instead of using CertFile and
+	// KeyFile. Path to the CA certificate to trust is logged on start.
+	// Requires UseTLS.
+	DevTLS bool `env:"HTTP_DEV_TLS"`
+
+	// DevTLSCacheDir persists generated CA and certificate, so the CA
+	// stays the same between restarts. If not set, certificates are kept
+	// in memory, and only CA certificate is written to "goapilib/devtls"
+	// in the user cache dir (see os.UserCacheDir). The CA is generated
+	// once per process and is replaced on each start.
+	DevTLSCacheDir string `env:"HTTP_DEV_TLS_CACHE_DIR"`
+
+	// CertReloadInterval sets how often CertFile and KeyFile are checked
+	// for changes, DefaultCertReloadInterval if not set
+	CertReloadInterval config.Duration `env:"HTTP_CERT_RELOAD_INTERVAL"`
+
+	// ClientAuth enables authentication of clients by certificates
+	// (mutual TLS), one of:
+	//
+	//	"request" - certificate is requested, but not required or verified
+	//	"require" - certificate is required, but not verified
+	//	"verify-if-given" - certificate is verified if the client sends it
+	//	"verify" - certificate is required and verified
+	//
+	// Certificates are verified against ClientCAFile.
+	ClientAuth string `env:"HTTP_CLIENT_AUTH"`
+
+	// ClientCAFile is a PEM bundle of CAs used to verify client certificates
+	ClientCAFile string `env:"HTTP_CLIENT_CA_FILE"`
+
+	// ClientAllowed lists patterns of allowed clients, for example
+	// "*.internal.example.com" or "spiffe://example.com/billing/*".
+	// Patterns (see path.Match) are matched against common name and
+	// DNS, email and URI SANs of the client certificate. Any client with
+	// a valid certificate is allowed if the list is empty. Requires
+	// ClientAuth to be "verify".
+	ClientAllowed config.List `env:"HTTP_CLIENT_ALLOWED"`
+
+	// ProxyProtocol enables PROXY protocol (version 1 or 2) used by load
+	// balancers to pass the address of the client (see ProxyListener)
+	ProxyProtocol bool `env:"HTTP_PROXY_PROTOCOL"`
+
+	// ProxyTrusted lists IP addresses or CIDRs of the load balancers,
+	// for example "10.0.0.0/8". Required for TCP listeners when
+	// ProxyProtocol is enabled: any client sending the header itself
+	// could pretend to have any address.
+	ProxyTrusted config.List `env:"HTTP_PROXY_TRUSTED"`
+
+	// ProxyHeaderTimeout limits time to read PROXY protocol header,
+	// DefaultProxyHeaderTimeout if not set
+	ProxyHeaderTimeout config.Duration `env:"HTTP_PROXY_HEADER_TIMEOUT"`
 }
 
+// DefaultReadHeaderTimeout is used when neither ReadHeaderTimeout nor
+// read timeout is configured, to protect from slow clients
+const DefaultReadHeaderTimeout = 10 * time.Second
+
+// DefaultCertReloadInterval is used when CertReloadInterval is not set
+const DefaultCertReloadInterval = time.Minute
+
+// IsValid checks that the server can be started with the configuration:
+// Address is a valid host name or IP address and Port is in range (unless
+// unix or systemd socket is used), unix socket options are valid and,
+// if TLS is enabled without DevTLS, certificate and key files are set.
+// Files are not read, see CheckFiles.
 func (cfg ServerConfig) IsValid() error {
 
-	if cfg.Port == 0 {
-		return config.FieldError{FieldName: "Port", Message: "not configured"}
+	switch {
+	case strings.HasPrefix(cfg.Address, UnixPrefix):
+		if cfg.socketPath() == "" {
+			return config.FieldError{FieldName: "Address", Message: "unix socket path cannot be empty"}
+		}
+
+	case strings.HasPrefix(cfg.Address, SystemdPrefix):
+
+	default:
+		if cfg.Port == 0 {
+			return config.FieldError{FieldName: "Port", Message: "not configured"}
+		}
+
+		if cfg.Port < 0 || cfg.Port > 65535 {
+			return config.FieldError{
+				FieldName: "Port",
+				Message:   fmt.Sprintf("%d is out of range 1-65535", cfg.Port)}
+		}
+
+		if !validHost(cfg.Address) {
+			return config.FieldError{
+				FieldName: "Address",
+				Message:   fmt.Sprintf("%q is not a valid host name or IP address", cfg.Address)}
+		}
 	}
 
-	if cfg.UseTLS {
+	sockets := []struct {
+		name string
+		val  string
+	}{
+		{"SocketMode", cfg.SocketMode},
+		{"SocketOwner", cfg.SocketOwner},
+		{"SocketGroup", cfg.SocketGroup},
+	}
+
+	for _, opt := range sockets {
+		if opt.val != "" && cfg.socketPath() == "" {
+			return config.FieldError{FieldName: opt.name, Message: "requires unix socket address"}
+		}
+	}
+
+	if _, err := socketMode(cfg.SocketMode); err != nil {
+		return config.FieldError{FieldName: "SocketMode", Message: err.Error()}
+	}
+
+	if _, err := lookupID(cfg.SocketOwner, lookupUser); err != nil {
+		return config.FieldError{FieldName: "SocketOwner", Message: err.Error()}
+	}
+
+	if _, err := lookupID(cfg.SocketGroup, lookupGroup); err != nil {
+		return config.FieldError{FieldName: "SocketGroup", Message: err.Error()}
+	}
+
+	durations := []struct {
+		name string
+		val  config.Duration
+	}{
+		{"Timeout", cfg.Timeout},
+		{"ReadTimeout", cfg.ReadTimeout},
+		{"ReadHeaderTimeout", cfg.ReadHeaderTimeout},
+		{"WriteTimeout", cfg.WriteTimeout},
+		{"IdleTimeout", cfg.IdleTimeout},
+		{"ShutdownTimeout", cfg.ShutdownTimeout},
+		{"CertReloadInterval", cfg.CertReloadInterval},
+		{"ProxyHeaderTimeout", cfg.ProxyHeaderTimeout},
+	}
+
+	for _, d := range durations {
+		if d.val < 0 {
+			return config.FieldError{FieldName: d.name, Message: "cannot be negative"}
+		}
+
+		// Timeout was an int number of seconds, and untyped constants
+		// like Timeout: 30 still compile as nanoseconds
+		if d.val > 0 && d.val.Duration() < time.Millisecond {
+			return config.FieldError{
+				FieldName: d.name,
+				Message:   fmt.Sprintf("%s is less than a millisecond, set seconds as config.Duration(%d * time.Second)", d.val, int64(d.val)),
+			}
+		}
+	}
+
+	if cfg.MaxHeaderBytes < 0 || int64(cfg.MaxHeaderBytes) > math.MaxInt32 {
+		return config.FieldError{FieldName: "MaxHeaderBytes", Message: fmt.Sprintf("%s is out of range", cfg.MaxHeaderBytes)}
+	}
+
+	if cfg.MaxBodySize < 0 {
+		return config.FieldError{FieldName: "MaxBodySize", Message: "cannot be negative"}
+	}
+
+	if _, err := tlsVersion(cfg.TLSMinVersion); err != nil {
+		return config.FieldError{FieldName: "TLSMinVersion", Message: err.Error()}
+	}
+
+	if _, err := cipherSuites(cfg.TLSCiphers); err != nil {
+		return config.FieldError{FieldName: "TLSCiphers", Message: err.Error()}
+	}
+
+	if _, err := curves(cfg.TLSCurves); err != nil {
+		return config.FieldError{FieldName: "TLSCurves", Message: err.Error()}
+	}
+
+	if _, err := clientAuthType(cfg.ClientAuth); err != nil {
+		return config.FieldError{FieldName: "ClientAuth", Message: err.Error()}
+	}
+
+	if cfg.ClientAuth != "" && !cfg.UseTLS {
+		return config.FieldError{FieldName: "ClientAuth", Message: "requires TLS to be enabled"}
+	}
+
+	if strings.HasPrefix(cfg.ClientAuth, "verify") && cfg.ClientCAFile == "" {
+		return config.FieldError{FieldName: "ClientCAFile", Message: "cannot be empty when client certificates are verified"}
+	}
+
+	if len(cfg.ClientAllowed) > 0 && cfg.ClientAuth != "verify" {
+		return config.FieldError{FieldName: "ClientAllowed", Message: `requires ClientAuth to be "verify"`}
+	}
+
+	for _, pattern := range cfg.ClientAllowed {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return config.FieldError{FieldName: "ClientAllowed", Message: fmt.Sprintf("invalid pattern %q", pattern)}
+		}
+	}
+
+	if _, err := parseNetworks(cfg.ProxyTrusted); err != nil {
+		return config.FieldError{FieldName: "ProxyTrusted", Message: err.Error()}
+	}
+
+	if !cfg.ProxyProtocol && len(cfg.ProxyTrusted) > 0 {
+		return config.FieldError{FieldName: "ProxyTrusted", Message: "requires ProxyProtocol to be enabled"}
+	}
+
+	if cfg.ProxyProtocol && len(cfg.ProxyTrusted) == 0 && cfg.socketPath() == "" {
+		return config.FieldError{FieldName: "ProxyTrusted", Message: "cannot be empty when ProxyProtocol is enabled"}
+	}
+
+	if cfg.DevTLS && !cfg.UseTLS {
+		return config.FieldError{FieldName: "DevTLS", Message: "requires TLS to be enabled"}
+	}
+
+	if cfg.UseTLS && !cfg.DevTLS {
 		if cfg.CertFile == "" {
 			return config.FieldError{
 				FieldName: "CertFile",
@@ -43,17 +305,119 @@ func (cfg ServerConfig) IsValid() error {
 	return nil
 }
 
+// CheckFiles reads the files of valid configuration (see IsValid) and
+// checks that, if TLS is enabled without DevTLS, certificate and key can
+// be read, match each other and the certificate chain is currently valid,
+// and that ClientCAFile holds certificates. Certificates expiring within
+// CertExpiryWarning are logged.
+//
+// It's meant to be called once on start, endpoint.Server does it.
+func (cfg ServerConfig) CheckFiles() error {
+	if cfg.UseTLS && !cfg.DevTLS {
+		if err := checkKeyPair(cfg.CertFile, cfg.KeyFile, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	if cfg.ClientCAFile != "" {
+		if _, err := loadCertPool(cfg.ClientCAFile); err != nil {
+			return config.FieldError{FieldName: "ClientCAFile", Message: err.Error()}
+		}
+	}
+
+	return nil
+}
+
+// Server returns HTTP server configured with all the parameters.
+// Configuration is expected to be valid (see IsValid).
+//
+// With TLS enabled, server's TLSConfig holds all TLS settings except the
+// certificate. Use TLSConfig to get the configuration with certificate.
 func (cfg ServerConfig) Server(handler http.Handler) *http.Server {
 
+	if cfg.MaxBodySize > 0 {
+		handler = http.MaxBytesHandler(handler, cfg.MaxBodySize.Bytes())
+	}
+
+	readTimeout := cfg.timeout(cfg.ReadTimeout)
+
+	readHeaderTimeout := cfg.ReadHeaderTimeout.Duration()
+	if readHeaderTimeout == 0 {
+		readHeaderTimeout = readTimeout
+	}
+	if readHeaderTimeout == 0 {
+		readHeaderTimeout = DefaultReadHeaderTimeout
+	}
+
 	srv := &http.Server{
-		Addr: fmt.Sprintf("%s:%d", cfg.Address, cfg.Port),
+		Addr: cfg.Addr(),
 
 		Handler: handler,
 
-		ReadTimeout:  time.Duration(cfg.Timeout) * time.Second,
-		WriteTimeout: time.Duration(cfg.Timeout) * time.Second,
-		IdleTimeout:  time.Duration(cfg.Timeout) * time.Second,
+		ReadTimeout:       readTimeout,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      cfg.timeout(cfg.WriteTimeout),
+		IdleTimeout:       cfg.timeout(cfg.IdleTimeout),
+
+		MaxHeaderBytes: int(cfg.MaxHeaderBytes),
+	}
+
+	if cfg.UseTLS {
+		srv.TLSConfig = cfg.tlsConfig()
+	}
+
+	if cfg.DisableHTTP2 {
+		// ServeTLS adds "h2" to NextProtos unless TLSNextProto is set
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+
+	if cfg.ProxyProtocol {
+		// Header is available to handlers, see ProxyHeaderFromContext
+		srv.ConnContext = proxyConnContext
 	}
 
+	srv.SetKeepAlivesEnabled(!cfg.DisableKeepAlives)
+
 	return srv
 }
+
+// Addr returns the address to listen on in the form "host:port", or
+// Address as is for unix and systemd sockets
+func (cfg ServerConfig) Addr() string {
+	if cfg.host() != cfg.Address {
+		return cfg.Address
+	}
+	return net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.Port))
+}
+
+// host returns Address if it's a host name or IP address, or empty
+// string for unix and systemd sockets
+func (cfg ServerConfig) host() string {
+	if strings.HasPrefix(cfg.Address, UnixPrefix) || strings.HasPrefix(cfg.Address, SystemdPrefix) {
+		return ""
+	}
+	return cfg.Address
+}
+
+// GracefulTimeout returns the time given to active requests to complete
+// when the server is stopped
+func (cfg ServerConfig) GracefulTimeout() time.Duration {
+	return cfg.timeout(cfg.ShutdownTimeout)
+}
+
+// ReloadInterval returns how often the certificate files are checked
+// for changes
+func (cfg ServerConfig) ReloadInterval() time.Duration {
+	if cfg.CertReloadInterval == 0 {
+		return DefaultCertReloadInterval
+	}
+	return cfg.CertReloadInterval.Duration()
+}
+
+// timeout returns d, or Timeout if d is not set
+func (cfg ServerConfig) timeout(d config.Duration) time.Duration {
+	if d == 0 {
+		return cfg.Timeout.Duration()
+	}
+	return d.Duration()
+}
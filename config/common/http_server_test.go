@@ -0,0 +1,248 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fednep/goapilib/config"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	der  []byte
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, name string, notAfter time.Time, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Cannot generate key: %s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Cannot create certificate: %s", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Cannot parse certificate: %s", err)
+	}
+
+	return &testCert{cert: cert, der: der, key: key}
+}
+
+func writeKeyPair(t *testing.T, key *ecdsa.PrivateKey, chain ...*testCert) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	var certPEM []byte
+	for _, c := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})...)
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Cannot marshal key: %s", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestServerConfigIsValid(t *testing.T) {
+	t.Parallel()
+
+	year := time.Now().AddDate(1, 0, 0)
+
+	ca := newTestCert(t, "Test CA", year, nil)
+	leaf := newTestCert(t, "localhost", year, ca)
+	otherCA := newTestCert(t, "Other CA", year, nil)
+	expired := newTestCert(t, "expired", time.Now().Add(-time.Minute), ca)
+
+	certFile, keyFile := writeKeyPair(t, leaf.key, leaf, ca)
+	brokenChain, brokenChainKey := writeKeyPair(t, leaf.key, leaf, otherCA)
+	expiredCert, expiredKey := writeKeyPair(t, expired.key, expired, ca)
+	_, otherKey := writeKeyPair(t, otherCA.key, otherCA)
+
+	tests := []struct {
+		name  string
+		cfg   ServerConfig
+		field string
+		err   string
+	}{
+		{"plain", ServerConfig{Address: "127.0.0.1", Port: 8080}, "", ""},
+		{"host name", ServerConfig{Address: "api.example.com", Port: 8080}, "", ""},
+		{"all interfaces", ServerConfig{Port: 8080}, "", ""},
+		{"ipv6", ServerConfig{Address: "::1", Port: 8080}, "", ""},
+		{"tls", ServerConfig{Port: 8443, UseTLS: true, CertFile: certFile, KeyFile: keyFile}, "", ""},
+
+		{"no port", ServerConfig{}, "Port", "not configured"},
+		{"port out of range", ServerConfig{Port: 70000}, "Port", "out of range"},
+		{"invalid address", ServerConfig{Address: "bad_host:80", Port: 8080}, "Address", "not a valid host"},
+		{"no cert", ServerConfig{Port: 8443, UseTLS: true}, "CertFile", "cannot be empty"},
+		{"missing cert", ServerConfig{Port: 8443, UseTLS: true, CertFile: "missing.pem", KeyFile: keyFile}, "CertFile", "cannot read"},
+		{"missing key", ServerConfig{Port: 8443, UseTLS: true, CertFile: certFile, KeyFile: "missing.pem"}, "KeyFile", "cannot read"},
+		{"not a cert", ServerConfig{Port: 8443, UseTLS: true, CertFile: keyFile, KeyFile: keyFile}, "CertFile", "no certificates"},
+		{"key mismatch", ServerConfig{Port: 8443, UseTLS: true, CertFile: certFile, KeyFile: otherKey}, "KeyFile", "invalid key pair"},
+		{"expired", ServerConfig{Port: 8443, UseTLS: true, CertFile: expiredCert, KeyFile: expiredKey}, "CertFile", "expired"},
+		{"broken chain", ServerConfig{Port: 8443, UseTLS: true, CertFile: brokenChain, KeyFile: brokenChainKey}, "CertFile", "is not signed by"},
+	}
+
+	// Files are not read by IsValid
+	missing := ServerConfig{Port: 8443, UseTLS: true, CertFile: "missing.pem", KeyFile: "missing.key"}
+	if err := missing.IsValid(); err != nil {
+		t.Errorf("Expected IsValid not to read files, got %s", err)
+	}
+
+	for _, tt := range tests {
+		err := tt.cfg.IsValid()
+		if err == nil {
+			err = tt.cfg.CheckFiles()
+		}
+
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", tt.name, err)
+			}
+			continue
+		}
+
+		fieldErr, ok := err.(config.FieldError)
+		if !ok {
+			t.Errorf("%s: expected FieldError, got %v", tt.name, err)
+			continue
+		}
+
+		if fieldErr.FieldName != tt.field || !strings.Contains(fieldErr.Message, tt.err) {
+			t.Errorf("%s: expected error %q in %s, got %s", tt.name, tt.err, tt.field, err)
+		}
+	}
+}
+
+func TestServerAddr(t *testing.T) {
+	srv := ServerConfig{Address: "::1", Port: 8080}.Server(nil)
+	if srv.Addr != "[::1]:8080" {
+		t.Errorf("Expected [::1]:8080, got %s", srv.Addr)
+	}
+}
+
+func TestServerKnobs(t *testing.T) {
+	cfg := ServerConfig{
+		Port:           8080,
+		UseTLS:         true,
+		Timeout:        config.Duration(time.Minute),
+		WriteTimeout:   config.Duration(10 * time.Minute),
+		MaxHeaderBytes: 64 * config.KiB,
+		MaxBodySize:    10,
+		TLSMinVersion:  "1.3",
+		TLSCiphers:     config.List{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	}
+
+	srv := cfg.Server(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}))
+
+	if srv.ReadTimeout != time.Minute || srv.ReadHeaderTimeout != time.Minute ||
+		srv.WriteTimeout != 10*time.Minute || srv.IdleTimeout != time.Minute {
+		t.Errorf("Invalid timeouts: read %s, header %s, write %s, idle %s",
+			srv.ReadTimeout, srv.ReadHeaderTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+
+	if cfg.GracefulTimeout() != time.Minute {
+		t.Errorf("Expected shutdown timeout to fall back to Timeout, got %s", cfg.GracefulTimeout())
+	}
+
+	if srv.MaxHeaderBytes != 64*1024 {
+		t.Errorf("Expected MaxHeaderBytes 65536, got %d", srv.MaxHeaderBytes)
+	}
+
+	if srv.TLSConfig == nil || srv.TLSConfig.MinVersion != tls.VersionTLS13 ||
+		len(srv.TLSConfig.CipherSuites) != 1 || srv.TLSConfig.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("Invalid TLS config: %+v", srv.TLSConfig)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader("more than ten bytes")))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected body to be limited, got status %d", rec.Code)
+	}
+
+	srv = ServerConfig{Port: 8080}.Server(nil)
+	if srv.ReadHeaderTimeout != DefaultReadHeaderTimeout || srv.TLSConfig != nil {
+		t.Errorf("Expected default read header timeout and no TLS, got %s, %v", srv.ReadHeaderTimeout, srv.TLSConfig)
+	}
+}
+
+func TestServerKnobsValidation(t *testing.T) {
+	tests := []struct {
+		cfg   ServerConfig
+		field string
+	}{
+		{ServerConfig{Port: 80, WriteTimeout: -1}, "WriteTimeout"},
+		{ServerConfig{Port: 80, Timeout: 30}, "Timeout"},
+		{ServerConfig{Port: 80, MaxBodySize: -1}, "MaxBodySize"},
+		{ServerConfig{Port: 80, MaxHeaderBytes: 4 * config.GiB}, "MaxHeaderBytes"},
+		{ServerConfig{Port: 80, TLSMinVersion: "1.4"}, "TLSMinVersion"},
+		{ServerConfig{Port: 80, TLSCiphers: config.List{"TLS_RSA_WITH_RC4_128_SHA"}}, "TLSCiphers"},
+		{ServerConfig{Port: 80, UseTLS: true, ClientAuth: "always"}, "ClientAuth"},
+		{ServerConfig{Port: 80, ClientAuth: "request"}, "ClientAuth"},
+		{ServerConfig{Port: 80, UseTLS: true, ClientAuth: "verify"}, "ClientCAFile"},
+		{ServerConfig{Port: 80, ClientAllowed: config.List{"[a-"}}, "ClientAllowed"},
+		{ServerConfig{Port: 80, UseTLS: true, DevTLS: true, ClientAuth: "require", ClientAllowed: config.List{"*.internal"}}, "ClientAllowed"},
+		{ServerConfig{Port: 80, UseTLS: true, DevTLS: true, ClientAuth: "request", ClientAllowed: config.List{"*.internal"}}, "ClientAllowed"},
+	}
+
+	for _, tt := range tests {
+		if path := config.FieldPath(tt.cfg.IsValid()); path != tt.field {
+			t.Errorf("Expected error in %s, got %v", tt.field, tt.cfg.IsValid())
+		}
+	}
+
+	cfg := ServerConfig{Port: 80, ClientCAFile: "missing.pem"}
+	if path := config.FieldPath(cfg.CheckFiles()); path != "ClientCAFile" {
+		t.Errorf("Expected error in ClientCAFile, got %v", cfg.CheckFiles())
+	}
+}
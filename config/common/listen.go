@@ -0,0 +1,236 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Prefixes of ServerConfig.Address selecting unix domain socket and
+// socket passed by systemd
+const (
+	UnixPrefix    = "unix:"
+	SystemdPrefix = "systemd:"
+)
+
+// Listen opens listener on the configured address:
+//
+//	"host" - TCP listener on host and Port
+//	"unix:/run/app.sock" - unix socket with SocketMode, SocketOwner and
+//		SocketGroup applied. Socket file left by a stopped process is
+//		removed, the file is removed when the listener is closed
+//	"systemd:" or "systemd:name" - socket passed with systemd socket
+//		activation (LISTEN_PID, LISTEN_FDS, LISTEN_FDNAMES environment
+//		variables). Name is set by FileDescriptorName= in the socket unit;
+//		without name, the first socket not used yet is taken
+//
+// Configuration is expected to be valid (see IsValid).
+func (cfg ServerConfig) Listen() (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(cfg.Address, UnixPrefix):
+		return cfg.listenUnix()
+	case strings.HasPrefix(cfg.Address, SystemdPrefix):
+		return systemdListener(strings.TrimPrefix(cfg.Address, SystemdPrefix))
+	}
+
+	return net.Listen("tcp", cfg.Addr())
+}
+
+// socketPath returns path of the unix socket, or empty string if the
+// address is not a unix socket
+func (cfg ServerConfig) socketPath() string {
+	if !strings.HasPrefix(cfg.Address, UnixPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(cfg.Address, UnixPrefix)
+}
+
+func (cfg ServerConfig) listenUnix() (net.Listener, error) {
+	fn := cfg.socketPath()
+
+	mode, err := socketMode(cfg.SocketMode)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := lookupID(cfg.SocketOwner, lookupUser)
+	if err != nil {
+		return nil, err
+	}
+
+	gid, err := lookupID(cfg.SocketGroup, lookupGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := removeStaleSocket(fn); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", fn)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		if err := os.Chmod(fn, mode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(fn, uid, gid); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+
+	return ln, nil
+}
+
+// dialSocket connects to the unix socket to check whether it is used
+var dialSocket = func(fn string) (net.Conn, error) {
+	return net.DialTimeout("unix", fn, time.Second)
+}
+
+// removeStaleSocket removes socket file nobody listens on, so the
+// server can be restarted after it was killed. The file is removed only
+// when connection is refused: on other errors, like permission denied or
+// timeout, the socket can still be used by another process.
+func removeStaleSocket(fn string) error {
+	fi, err := os.Lstat(fn)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if fi.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", fn)
+	}
+
+	conn, err := dialSocket(fn)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is used by another process", fn)
+	}
+
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("cannot check whether %s is used: %w", fn, err)
+	}
+
+	return os.Remove(fn)
+}
+
+// socketMode parses octal permissions of the socket, 0 if not set
+func socketMode(mode string) (fs.FileMode, error) {
+	if mode == "" {
+		return 0, nil
+	}
+
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m == 0 || m > 0o777 {
+		return 0, fmt.Errorf("%q is not a valid octal mode, expected for example \"0660\"", mode)
+	}
+
+	return fs.FileMode(m), nil
+}
+
+// lookupID returns numeric id of the user or group given by name or id,
+// -1 if not set
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(id)
+}
+
+func lookupUser(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+func lookupGroup(name string) (string, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", err
+	}
+	return g.Gid, nil
+}
+
+// First file descriptor passed by systemd, see sd_listen_fds(3)
+var listenFDsStart = 3
+
+var (
+	listenFDsMu   sync.Mutex
+	listenFDsUsed = map[int]bool{}
+)
+
+// systemdListener returns listener from the socket passed by systemd with
+// the name, or the first socket not used yet if name is empty
+func systemdListener(name string) (net.Listener, error) {
+	if pid := os.Getenv("LISTEN_PID"); pid != strconv.Itoa(os.Getpid()) {
+		return nil, errors.New("socket activation: sockets are not passed to this process")
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, errors.New("socket activation: no sockets passed")
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	listenFDsMu.Lock()
+	defer listenFDsMu.Unlock()
+
+	for i := 0; i < n; i++ {
+		fd := listenFDsStart + i
+		if listenFDsUsed[fd] {
+			continue
+		}
+
+		if name != "" && (i >= len(names) || names[i] != name) {
+			continue
+		}
+
+		// FileListener duplicates the descriptor, so the passed one is closed
+		f := os.NewFile(uintptr(fd), SystemdPrefix+name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket activation: descriptor %d: %w", fd, err)
+		}
+
+		listenFDsUsed[fd] = true
+		return ln, nil
+	}
+
+	if name == "" {
+		return nil, errors.New("socket activation: all passed sockets are used")
+	}
+
+	return nil, fmt.Errorf("socket activation: no unused socket named %q", name)
+}
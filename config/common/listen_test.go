@@ -0,0 +1,215 @@
+//go:build !windows
+
+package common
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/fednep/goapilib/config"
+)
+
+func TestListenUnix(t *testing.T) {
+	// Socket paths are limited to ~100 bytes, TempDir can be longer
+	dir, err := os.MkdirTemp("", "sock")
+	if err != nil {
+		t.Fatalf("Cannot create dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "app.sock")
+
+	// Socket left by a killed process
+	stale, err := net.Listen("unix", fn)
+	if err != nil {
+		t.Fatalf("Cannot listen: %s", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	cfg := ServerConfig{
+		Address:     UnixPrefix + fn,
+		SocketMode:  "0600",
+		SocketOwner: strconv.Itoa(os.Getuid()),
+		SocketGroup: strconv.Itoa(os.Getgid()),
+	}
+	if err := cfg.IsValid(); err != nil {
+		t.Fatalf("Expected configuration to be valid: %s", err)
+	}
+
+	ln, err := cfg.Listen()
+	if err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+
+	fi, err := os.Stat(fn)
+	if err != nil {
+		t.Fatalf("Cannot stat socket: %s", err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Errorf("Expected mode 0600, got %o", fi.Mode().Perm())
+	}
+
+	conn, err := net.Dial("unix", fn)
+	if err != nil {
+		t.Fatalf("Cannot connect: %s", err)
+	}
+	conn.Close()
+
+	if _, err := cfg.Listen(); err == nil || !strings.Contains(err.Error(), "used by another process") {
+		t.Errorf("Expected error for socket in use, got %v", err)
+	}
+
+	ln.Close()
+	if _, err := os.Stat(fn); !os.IsNotExist(err) {
+		t.Errorf("Expected socket to be removed on close")
+	}
+
+	if err := os.WriteFile(fn, nil, 0o644); err != nil {
+		t.Fatalf("Cannot write file: %s", err)
+	}
+	if _, err := cfg.Listen(); err == nil || !strings.Contains(err.Error(), "not a socket") {
+		t.Errorf("Expected error for regular file, got %v", err)
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "sock")
+	if err != nil {
+		t.Fatalf("Cannot create dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "app.sock")
+	stale, err := net.Listen("unix", fn)
+	if err != nil {
+		t.Fatalf("Cannot listen: %s", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	defer func(dial func(string) (net.Conn, error)) {
+		dialSocket = dial
+	}(dialSocket)
+
+	// Socket which can't be checked is not removed
+	for _, errno := range []syscall.Errno{syscall.EACCES, syscall.ETIMEDOUT} {
+		dialSocket = func(string) (net.Conn, error) {
+			return nil, &net.OpError{Op: "dial", Net: "unix", Err: os.NewSyscallError("connect", errno)}
+		}
+
+		if err := removeStaleSocket(fn); err == nil {
+			t.Errorf("Expected error for %s", errno)
+		}
+
+		if _, err := os.Lstat(fn); err != nil {
+			t.Fatalf("Socket is removed after %s: %s", errno, err)
+		}
+	}
+
+	dialSocket = func(string) (net.Conn, error) {
+		return nil, &net.OpError{Op: "dial", Net: "unix", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	}
+
+	if err := removeStaleSocket(fn); err != nil {
+		t.Fatalf("removeStaleSocket returned error: %s", err)
+	}
+
+	if _, err := os.Lstat(fn); err == nil {
+		t.Errorf("Stale socket is not removed")
+	}
+}
+
+func TestListenValidation(t *testing.T) {
+	tests := []struct {
+		cfg   ServerConfig
+		field string
+	}{
+		{ServerConfig{Address: "unix:"}, "Address"},
+		{ServerConfig{Address: "unix:/run/app.sock", SocketMode: "rw"}, "SocketMode"},
+		{ServerConfig{Address: "unix:/run/app.sock", SocketMode: "01000"}, "SocketMode"},
+		{ServerConfig{Address: "unix:/run/app.sock", SocketOwner: "no-such-user-here"}, "SocketOwner"},
+		{ServerConfig{Address: "unix:/run/app.sock", SocketGroup: "no-such-group-here"}, "SocketGroup"},
+		{ServerConfig{Port: 8080, SocketMode: "0660"}, "SocketMode"},
+		{ServerConfig{Address: "systemd:api", SocketOwner: "0"}, "SocketOwner"},
+	}
+
+	for _, tt := range tests {
+		err := tt.cfg.IsValid()
+		fe, ok := err.(config.FieldError)
+		if !ok || fe.FieldName != tt.field {
+			t.Errorf("%+v: expected error for %s, got %v", tt.cfg, tt.field, err)
+		}
+	}
+
+	for _, cfg := range []ServerConfig{
+		{Address: "unix:/run/app.sock", SocketMode: "660"},
+		{Address: "systemd:"},
+		{Address: "systemd:api"},
+	} {
+		if err := cfg.IsValid(); err != nil {
+			t.Errorf("%+v: expected to be valid, got %s", cfg, err)
+		}
+	}
+}
+
+func TestListenSystemd(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %s", err)
+	}
+	defer tcp.Close()
+
+	// Descriptor passed to the process, owned by systemdListener
+	raw, err := tcp.(*net.TCPListener).SyscallConn()
+	if err != nil {
+		t.Fatalf("SyscallConn: %s", err)
+	}
+
+	fd := -1
+	raw.Control(func(s uintptr) { fd, err = syscall.Dup(int(s)) })
+	if err != nil {
+		t.Fatalf("Cannot duplicate descriptor: %s", err)
+	}
+
+	defer func(start int) {
+		listenFDsStart = start
+		listenFDsUsed = map[int]bool{}
+	}(listenFDsStart)
+	listenFDsStart = fd
+
+	cfg := ServerConfig{Address: SystemdPrefix + "api"}
+
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "api")
+
+	if _, err := cfg.Listen(); err == nil {
+		t.Errorf("Expected error for sockets passed to another process")
+	}
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+
+	if _, err := (ServerConfig{Address: SystemdPrefix + "admin"}).Listen(); err == nil {
+		t.Errorf("Expected error for socket name which wasn't passed")
+	}
+
+	ln, err := cfg.Listen()
+	if err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	defer ln.Close()
+
+	if ln.Addr().String() != tcp.Addr().String() {
+		t.Errorf("Expected listener on %s, got %s", tcp.Addr(), ln.Addr())
+	}
+
+	if _, err := (ServerConfig{Address: SystemdPrefix}).Listen(); err == nil {
+		t.Errorf("Expected error when all passed sockets are used")
+	}
+}
@@ -0,0 +1,439 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProxyHeaderTimeout is used when ProxyHeaderTimeout is not set
+const DefaultProxyHeaderTimeout = 5 * time.Second
+
+// ProxyHeader holds connection information passed by a load balancer
+// with PROXY protocol
+type ProxyHeader struct {
+	// Version of the protocol, 1 or 2
+	Version int
+
+	// Source and Destination are addresses of the original connection,
+	// nil if the load balancer didn't pass them (health checks)
+	Source      net.Addr
+	Destination net.Addr
+
+	// ALPN and Authority (server name sent by the client) are passed
+	// with version 2 only
+	ALPN      string
+	Authority string
+
+	// TLS is set if the client connected to the load balancer with TLS,
+	// passed with version 2 only
+	TLS *ProxyTLS
+}
+
+// ProxyTLS holds information about TLS connection terminated by the
+// load balancer
+type ProxyTLS struct {
+	Version string
+	Cipher  string
+
+	// ClientCert is set if the client presented a certificate,
+	// Verified if it was verified successfully
+	ClientCert bool
+	Verified   bool
+	CommonName string
+}
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Types of the PROXY protocol v2 TLVs
+const (
+	proxyTLVALPN       = 0x01
+	proxyTLVAuthority  = 0x02
+	proxyTLVSSL        = 0x20
+	proxyTLVSSLVersion = 0x21
+	proxyTLVSSLCN      = 0x22
+	proxyTLVSSLCipher  = 0x23
+)
+
+// ProxyListener returns ln accepting connections with PROXY protocol
+// header if ProxyProtocol is enabled, or ln itself otherwise.
+//
+// Header is read from connections from ProxyTrusted sources (and always
+// from unix sockets) at most for ProxyHeaderTimeout, connection is closed
+// if it's missing or invalid.
+// Remote and local addresses of the connections are replaced with the
+// addresses from the header. Connections from other sources are accepted
+// without header.
+//
+// Configuration is expected to be valid (see IsValid).
+func (cfg ServerConfig) ProxyListener(ln net.Listener) net.Listener {
+	if !cfg.ProxyProtocol {
+		return ln
+	}
+
+	trusted, _ := parseNetworks(cfg.ProxyTrusted)
+
+	timeout := cfg.ProxyHeaderTimeout.Duration()
+	if timeout == 0 {
+		timeout = DefaultProxyHeaderTimeout
+	}
+
+	return &proxyListener{Listener: ln, trusted: trusted, timeout: timeout}
+}
+
+// ProxyHeaderFromContext returns PROXY protocol header of the connection
+// the request context belongs to (see http.Request.Context)
+func ProxyHeaderFromContext(ctx context.Context) (*ProxyHeader, bool) {
+	conn, ok := ctx.Value(proxyConnKey{}).(*proxyConn)
+	if !ok {
+		return nil, false
+	}
+
+	h, err := conn.readHeader()
+	if err != nil || h == nil {
+		return nil, false
+	}
+
+	return h, true
+}
+
+type proxyConnKey struct{}
+
+// proxyConnContext adds connection with PROXY protocol header to the
+// context, see ProxyHeaderFromContext
+func proxyConnContext(ctx context.Context, c net.Conn) context.Context {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+
+	if pc, ok := c.(*proxyConn); ok {
+		return context.WithValue(ctx, proxyConnKey{}, pc)
+	}
+
+	return ctx
+}
+
+type proxyListener struct {
+	net.Listener
+	trusted []*net.IPNet
+	timeout time.Duration
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if !l.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+
+	// Header is read by the goroutine serving the connection, so slow
+	// clients don't block Accept
+	return &proxyConn{Conn: conn, r: bufio.NewReader(conn), timeout: l.timeout}, nil
+}
+
+func (l *proxyListener) isTrusted(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+
+	for _, n := range l.trusted {
+		if n.Contains(tcp.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// proxyConn reads PROXY protocol header before any other operation
+type proxyConn struct {
+	net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+
+	once   sync.Once
+	header *ProxyHeader
+	err    error
+}
+
+func (c *proxyConn) readHeader() (*ProxyHeader, error) {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.header, c.err = readProxyHeader(c.r)
+		c.Conn.SetReadDeadline(time.Time{})
+
+		if c.err != nil {
+			c.err = fmt.Errorf("PROXY protocol from %s: %w", c.Conn.RemoteAddr(), c.err)
+		}
+	})
+
+	return c.header, c.err
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	if _, err := c.readHeader(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if h, _ := c.readHeader(); h != nil && h.Source != nil {
+		return h.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	if h, _ := c.readHeader(); h != nil && h.Destination != nil {
+		return h.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// readProxyHeader reads header of version 1 or 2
+func readProxyHeader(r *bufio.Reader) (*ProxyHeader, error) {
+	// Shortest valid header "PROXY UNKNOWN\r\n" is longer than v2 signature
+	prefix, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read header: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(prefix, proxyV2Signature):
+		return readProxyV2(r)
+	case string(prefix[:6]) == "PROXY ":
+		return readProxyV1(r)
+	}
+
+	return nil, errors.New("header is missing")
+}
+
+// readProxyV1 reads text header, for example:
+//
+//	PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n
+func readProxyV1(r *bufio.Reader) (*ProxyHeader, error) {
+	// Header is at most 107 bytes long including CRLF
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read header: %w", err)
+		}
+
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("header line is too long")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	h := &ProxyHeader{Version: 1}
+
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return h, nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid header %q", line)
+	}
+
+	src, err := proxyV1Addr(fields[2], fields[4], fields[1] == "TCP6")
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := proxyV1Addr(fields[3], fields[5], fields[1] == "TCP6")
+	if err != nil {
+		return nil, err
+	}
+
+	h.Source, h.Destination = src, dst
+	return h, nil
+}
+
+func proxyV1Addr(host, port string, v6 bool) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || (ip.To4() == nil) != v6 {
+		return nil, fmt.Errorf("invalid address %q", host)
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", port)
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readProxyV2 reads binary header with optional TLVs
+func readProxyV2(r *bufio.Reader) (*ProxyHeader, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("cannot read header: %w", err)
+	}
+
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported version %d", hdr[12]>>4)
+	}
+
+	data := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("cannot read header: %w", err)
+	}
+
+	h := &ProxyHeader{Version: 2}
+
+	switch hdr[12] & 0x0f {
+	case 0x0:
+		// LOCAL command is sent by the load balancer itself
+		return h, nil
+	case 0x1:
+	default:
+		return nil, fmt.Errorf("unsupported command %d", hdr[12]&0x0f)
+	}
+
+	var addrLen int
+	switch hdr[13] >> 4 {
+	case 0x1:
+		addrLen = 12
+	case 0x2:
+		addrLen = 36
+	case 0x3:
+		addrLen = 216
+	default:
+		// Unspecified family, addresses are ignored
+		return h, nil
+	}
+
+	if len(data) < addrLen {
+		return nil, errors.New("header is too short")
+	}
+
+	// Only TCP (STREAM) addresses are exposed, addresses of unix
+	// sockets don't identify the client
+	if hdr[13]&0x0f == 0x1 && addrLen != 216 {
+		ipLen := (addrLen - 4) / 2
+		h.Source = &net.TCPAddr{
+			IP:   net.IP(append([]byte{}, data[:ipLen]...)),
+			Port: int(binary.BigEndian.Uint16(data[2*ipLen:])),
+		}
+		h.Destination = &net.TCPAddr{
+			IP:   net.IP(append([]byte{}, data[ipLen:2*ipLen]...)),
+			Port: int(binary.BigEndian.Uint16(data[2*ipLen+2:])),
+		}
+	}
+
+	err := parseProxyTLVs(data[addrLen:], func(typ byte, val []byte) error {
+		switch typ {
+		case proxyTLVALPN:
+			h.ALPN = string(val)
+		case proxyTLVAuthority:
+			h.Authority = string(val)
+		case proxyTLVSSL:
+			return parseProxySSL(h, val)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// parseProxySSL parses PP2_TYPE_SSL value: client flags, verification
+// result and sub-TLVs
+func parseProxySSL(h *ProxyHeader, val []byte) error {
+	if len(val) < 5 {
+		return errors.New("invalid SSL TLV")
+	}
+
+	client := val[0]
+	if client&0x01 == 0 {
+		return nil
+	}
+
+	h.TLS = &ProxyTLS{
+		ClientCert: client&0x06 != 0,
+		Verified:   client&0x06 != 0 && binary.BigEndian.Uint32(val[1:5]) == 0,
+	}
+
+	return parseProxyTLVs(val[5:], func(typ byte, val []byte) error {
+		switch typ {
+		case proxyTLVSSLVersion:
+			h.TLS.Version = string(val)
+		case proxyTLVSSLCipher:
+			h.TLS.Cipher = string(val)
+		case proxyTLVSSLCN:
+			h.TLS.CommonName = string(val)
+		}
+		return nil
+	})
+}
+
+func parseProxyTLVs(data []byte, fn func(typ byte, val []byte) error) error {
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return errors.New("invalid TLV")
+		}
+
+		n := int(binary.BigEndian.Uint16(data[1:3]))
+		if len(data) < 3+n {
+			return errors.New("invalid TLV length")
+		}
+
+		if err := fn(data[0], data[3:3+n]); err != nil {
+			return err
+		}
+		data = data[3+n:]
+	}
+
+	return nil
+}
+
+// parseNetworks parses CIDRs or single IP addresses
+func parseNetworks(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not a valid IP address or CIDR", s)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid IP address or CIDR", s)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
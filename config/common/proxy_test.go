@@ -0,0 +1,258 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fednep/goapilib/config"
+)
+
+func proxyTLV(typ byte, val []byte) []byte {
+	tlv := []byte{typ, 0, 0}
+	binary.BigEndian.PutUint16(tlv[1:], uint16(len(val)))
+	return append(tlv, val...)
+}
+
+// proxyV2 builds version 2 header for TCP connection
+func proxyV2(cmd byte, src, dst *net.TCPAddr, tlvs ...[]byte) []byte {
+	var addrs []byte
+	fam := byte(0x11)
+
+	if src != nil {
+		srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+		if srcIP == nil {
+			srcIP, dstIP, fam = src.IP.To16(), dst.IP.To16(), 0x21
+		}
+
+		addrs = append(append(addrs, srcIP...), dstIP...)
+		addrs = append(addrs, byte(src.Port>>8), byte(src.Port))
+		addrs = append(addrs, byte(dst.Port>>8), byte(dst.Port))
+	} else {
+		fam = 0
+	}
+
+	for _, tlv := range tlvs {
+		addrs = append(addrs, tlv...)
+	}
+
+	hdr := append([]byte{}, proxyV2Signature...)
+	hdr = append(hdr, 0x20|cmd, fam)
+	hdr = append(hdr, byte(len(addrs)>>8), byte(len(addrs)))
+	return append(hdr, addrs...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 443}
+	src6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324}
+	dst6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}
+
+	ssl := []byte{0x01 | 0x02, 0, 0, 0, 0}
+	ssl = append(ssl, proxyTLV(proxyTLVSSLVersion, []byte("TLSv1.3"))...)
+	ssl = append(ssl, proxyTLV(proxyTLVSSLCipher, []byte("TLS_AES_128_GCM_SHA256"))...)
+	ssl = append(ssl, proxyTLV(proxyTLVSSLCN, []byte("client.example.com"))...)
+
+	tests := []struct {
+		name   string
+		header []byte
+		want   ProxyHeader
+		err    string
+	}{
+		{
+			name:   "v1 TCP4",
+			header: []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"),
+			want:   ProxyHeader{Version: 1, Source: src, Destination: dst},
+		},
+		{
+			name:   "v1 TCP6",
+			header: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"),
+			want:   ProxyHeader{Version: 1, Source: src6, Destination: dst6},
+		},
+		{
+			name:   "v1 UNKNOWN",
+			header: []byte("PROXY UNKNOWN\r\n"),
+			want:   ProxyHeader{Version: 1},
+		},
+		{
+			name:   "v1 invalid address",
+			header: []byte("PROXY TCP4 2001:db8::1 192.0.2.2 56324 443\r\n"),
+			err:    "invalid address",
+		},
+		{
+			name:   "v1 invalid port",
+			header: []byte("PROXY TCP4 192.0.2.1 192.0.2.2 65536 443\r\n"),
+			err:    "invalid port",
+		},
+		{
+			name:   "v1 too long",
+			header: []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"),
+			err:    "too long",
+		},
+		{
+			name:   "v2 TCP4",
+			header: proxyV2(0x1, src, dst),
+			want:   ProxyHeader{Version: 2, Source: src, Destination: dst},
+		},
+		{
+			name:   "v2 TCP6",
+			header: proxyV2(0x1, src6, dst6),
+			want:   ProxyHeader{Version: 2, Source: src6, Destination: dst6},
+		},
+		{
+			name:   "v2 LOCAL",
+			header: proxyV2(0x0, nil, nil),
+			want:   ProxyHeader{Version: 2},
+		},
+		{
+			name: "v2 TLVs",
+			header: proxyV2(0x1, src, dst,
+				proxyTLV(proxyTLVALPN, []byte("h2")),
+				proxyTLV(proxyTLVAuthority, []byte("api.example.com")),
+				proxyTLV(proxyTLVSSL, ssl)),
+			want: ProxyHeader{
+				Version: 2, Source: src, Destination: dst, ALPN: "h2", Authority: "api.example.com",
+				TLS: &ProxyTLS{
+					Version: "TLSv1.3", Cipher: "TLS_AES_128_GCM_SHA256",
+					ClientCert: true, Verified: true, CommonName: "client.example.com",
+				},
+			},
+		},
+		{
+			name:   "v2 invalid TLV",
+			header: append(proxyV2(0x1, src, dst)[:14], 0, 14, 192, 0, 2, 1, 192, 0, 2, 2, 0, 1, 0, 2, 0x01, 0),
+			err:    "invalid TLV",
+		},
+		{
+			name:   "missing",
+			header: []byte("GET / HTTP/1.1\r\n"),
+			err:    "header is missing",
+		},
+	}
+
+	for _, tt := range tests {
+		r := bufio.NewReader(io.MultiReader(bytes.NewReader(tt.header), strings.NewReader("GET / HTTP/1.1\r\n")))
+		h, err := readProxyHeader(r)
+
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected error %q, got %v", tt.name, tt.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		if h.Version != tt.want.Version || h.ALPN != tt.want.ALPN || h.Authority != tt.want.Authority ||
+			addrString(h.Source) != addrString(tt.want.Source) ||
+			addrString(h.Destination) != addrString(tt.want.Destination) {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.want, h)
+		}
+
+		if (h.TLS == nil) != (tt.want.TLS == nil) || (h.TLS != nil && *h.TLS != *tt.want.TLS) {
+			t.Errorf("%s: expected TLS %+v, got %+v", tt.name, tt.want.TLS, h.TLS)
+		}
+
+		if rest, _ := io.ReadAll(r); string(rest) != "GET / HTTP/1.1\r\n" {
+			t.Errorf("%s: data after header is not preserved: %q", tt.name, rest)
+		}
+	}
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+func TestProxyListener(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted config.List
+		send    string
+		remote  string
+		err     bool
+	}{
+		{"trusted", config.List{"127.0.0.0/8"}, "PROXY TCP4 192.0.2.1 127.0.0.1 56324 443\r\nhello", "192.0.2.1:56324", false},
+		{"untrusted", config.List{"10.0.0.1"}, "hello", "127.0.0.1", false},
+		{"missing header", config.List{"127.0.0.1"}, "hello", "127.0.0.1", true},
+		{"timeout", config.List{"127.0.0.1"}, "", "127.0.0.1", true},
+	}
+
+	for _, tt := range tests {
+		inner, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Cannot listen: %s", err)
+		}
+
+		cfg := ServerConfig{Port: 8080, ProxyProtocol: true, ProxyTrusted: tt.trusted, ProxyHeaderTimeout: config.Duration(50 * time.Millisecond)}
+		if err := cfg.IsValid(); err != nil {
+			t.Fatalf("%s: expected configuration to be valid: %s", tt.name, err)
+		}
+		ln := cfg.ProxyListener(inner)
+
+		client, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatalf("Cannot connect: %s", err)
+		}
+		client.Write([]byte(tt.send))
+
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatalf("%s: Accept: %s", tt.name, err)
+		}
+
+		if remote := conn.RemoteAddr().String(); !strings.HasPrefix(remote, tt.remote) {
+			t.Errorf("%s: expected remote address %s, got %s", tt.name, tt.remote, remote)
+		}
+
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(conn, buf)
+		if tt.err != (err != nil) {
+			t.Errorf("%s: unexpected read error: %v", tt.name, err)
+		}
+		if !tt.err && string(buf) != "hello" {
+			t.Errorf("%s: expected data after header, got %q", tt.name, buf)
+		}
+
+		client.Close()
+		conn.Close()
+		ln.Close()
+	}
+}
+
+func TestProxyValidation(t *testing.T) {
+	tests := []struct {
+		cfg   ServerConfig
+		field string
+	}{
+		{ServerConfig{Port: 8080, ProxyProtocol: true, ProxyTrusted: config.List{"10.0.0.0/33"}}, "ProxyTrusted"},
+		{ServerConfig{Port: 8080, ProxyProtocol: true, ProxyTrusted: config.List{"lb.example.com"}}, "ProxyTrusted"},
+		{ServerConfig{Port: 8080, ProxyTrusted: config.List{"10.0.0.0/8"}}, "ProxyTrusted"},
+		{ServerConfig{Port: 8080, ProxyProtocol: true, ProxyTrusted: config.List{"10.0.0.1"}, ProxyHeaderTimeout: -1}, "ProxyHeaderTimeout"},
+		{ServerConfig{Port: 8080, ProxyProtocol: true}, "ProxyTrusted"},
+	}
+
+	for _, tt := range tests {
+		err := tt.cfg.IsValid()
+		fe, ok := err.(config.FieldError)
+		if !ok || fe.FieldName != tt.field {
+			t.Errorf("%+v: expected error for %s, got %v", tt.cfg, tt.field, err)
+		}
+	}
+
+	// Only the proxy can connect to the unix socket
+	cfg := ServerConfig{Address: "unix:/run/api.sock", ProxyProtocol: true}
+	if err := cfg.IsValid(); err != nil {
+		t.Errorf("Expected unix socket without ProxyTrusted to be valid, got %s", err)
+	}
+}
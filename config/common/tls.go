@@ -0,0 +1,280 @@
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// TLSConfig returns TLS configuration of the server with the certificate
+// loaded from CertFile and KeyFile, or generated in development mode:
+//
+//	tlsConfig, err := cfg.TLSConfig()
+//	...
+//	srv := cfg.Server(handler)
+//	srv.TLSConfig = tlsConfig
+//	err = srv.ServeTLS(ln, "", "")
+//
+// The certificate is loaded once and is not reloaded when CertFile or
+// KeyFile change. To pick up rotated certificates, use CertLoader with
+// TLSConfigWith and run Watch of the loader, as endpoint.Server does:
+//
+//	certs, err := cfg.CertLoader()
+//	...
+//	tlsConfig, err := cfg.TLSConfigWith(certs)
+//	...
+//	go certs.Watch(ctx, cfg.ReloadInterval())
+func (cfg ServerConfig) TLSConfig() (*tls.Config, error) {
+	loader, err := cfg.CertLoader()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg.TLSConfigWith(loader)
+}
+
+// TLSConfigWith returns TLS configuration of the server which takes
+// the certificate from the loader, so it is reloaded without restart
+// while the loader is watched (see CertLoader.Watch)
+func (cfg ServerConfig) TLSConfigWith(loader *CertLoader) (*tls.Config, error) {
+	if _, err := tlsVersion(cfg.TLSMinVersion); err != nil {
+		return nil, err
+	}
+
+	if _, err := cipherSuites(cfg.TLSCiphers); err != nil {
+		return nil, err
+	}
+
+	if _, err := curves(cfg.TLSCurves); err != nil {
+		return nil, err
+	}
+
+	if _, err := clientAuthType(cfg.ClientAuth); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := cfg.tlsConfig()
+
+	if cfg.ClientCAFile != "" {
+		pool, err := loadCertPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client CAs: %w", err)
+		}
+		tlsConfig.ClientCAs = pool
+	}
+
+	tlsConfig.GetCertificate = loader.GetCertificate
+	return tlsConfig, nil
+}
+
+// tlsConfig returns TLS configuration without certificates
+func (cfg ServerConfig) tlsConfig() *tls.Config {
+	// Errors are reported by IsValid and CheckFiles
+	minVersion, _ := tlsVersion(cfg.TLSMinVersion)
+	ciphers, _ := cipherSuites(cfg.TLSCiphers)
+	curvePreferences, _ := curves(cfg.TLSCurves)
+
+	clientAuth, _ := clientAuthType(cfg.ClientAuth)
+
+	tlsConfig := &tls.Config{
+		MinVersion:       minVersion,
+		CipherSuites:     ciphers,
+		CurvePreferences: curvePreferences,
+		ClientAuth:       clientAuth,
+		NextProtos:       []string{"h2", "http/1.1"},
+	}
+
+	if cfg.DisableHTTP2 {
+		tlsConfig.NextProtos = []string{"http/1.1"}
+	}
+
+	if cfg.ClientCAFile != "" {
+		tlsConfig.ClientCAs, _ = loadCertPool(cfg.ClientCAFile)
+	}
+
+	if len(cfg.ClientAllowed) > 0 {
+		allowed := cfg.ClientAllowed
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			// Only certificates verified against ClientCAFile can be trusted
+			// to hold the names they claim
+			if len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+				return fmt.Errorf("client certificate is required")
+			}
+
+			return checkClientAllowed(cs.VerifiedChains[0][0], allowed)
+		}
+	}
+
+	return tlsConfig
+}
+
+var curveIDs = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// curves returns IDs of the curves by names, "P-256" and "P256"
+// are both accepted
+func curves(names []string) ([]tls.CurveID, error) {
+	var ids []tls.CurveID
+
+	for _, name := range names {
+		id, ok := curveIDs[strings.ToUpper(strings.ReplaceAll(name, "-", ""))]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %q, expected X25519, P256, P384 or P521", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// CertLoader holds the certificate loaded from files and provides it to
+// the TLS server with GetCertificate. Certificate can be reloaded when
+// the files are changed, for example by an agent rotating certificates
+// (see Watch).
+type CertLoader struct {
+	CertFile string
+	KeyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	notAfter time.Time
+
+	// checksum of the files which were loaded or failed to load last time
+	checksum [sha256.Size]byte
+}
+
+// NewCertLoader loads certificate and key from the files
+func NewCertLoader(certFile, keyFile string) (*CertLoader, error) {
+	l := &CertLoader{CertFile: certFile, KeyFile: keyFile}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// newStaticCertLoader returns loader holding the certificate which is
+// not loaded from files
+func newStaticCertLoader(cert tls.Certificate) *CertLoader {
+	return &CertLoader{cert: &cert, notAfter: cert.Leaf.NotAfter}
+}
+
+// Reload loads certificate and key from the files again. If they cannot
+// be loaded, the current certificate is kept.
+func (l *CertLoader) Reload() error {
+	_, err := l.reload(false)
+	return err
+}
+
+// reload loads the files, and if onlyChanged is set, only if they differ
+// from the ones loaded last time. Returns true if the files were loaded.
+func (l *CertLoader) reload(onlyChanged bool) (bool, error) {
+	if l.CertFile == "" {
+		return false, nil
+	}
+
+	certPEM, err := os.ReadFile(l.CertFile)
+	if err != nil {
+		return false, fmt.Errorf("cannot load certificate: %w", err)
+	}
+
+	keyPEM, err := os.ReadFile(l.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("cannot load certificate: %w", err)
+	}
+
+	checksum := sha256.Sum256(append(append([]byte{}, certPEM...), keyPEM...))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if onlyChanged && checksum == l.checksum {
+		return false, nil
+	}
+	l.checksum = checksum
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("cannot load certificate: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return false, fmt.Errorf("cannot load certificate: %w", err)
+	}
+
+	l.cert = &cert
+	l.notAfter = leaf.NotAfter
+
+	return true, nil
+}
+
+// GetCertificate returns current certificate, it is used as
+// tls.Config.GetCertificate
+func (l *CertLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.cert, nil
+}
+
+// NotAfter returns expiration time of the current certificate,
+// for example to report it in health checks
+func (l *CertLoader) NotAfter() time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.notAfter
+}
+
+// Watch checks the files every interval and reloads the certificate when
+// they are changed, or when the process receives SIGHUP. Blocks until ctx
+// is done. Certificates which cannot be loaded are logged, and the current
+// certificate is kept until the files are fixed.
+func (l *CertLoader) Watch(ctx context.Context, interval time.Duration) {
+	if l.CertFile == "" {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		onlyChanged := true
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			onlyChanged = false
+		case <-ticker.C:
+		}
+
+		loaded, err := l.reload(onlyChanged)
+		if err != nil {
+			log.Printf("Keeping current certificate, new one is invalid: %s", err)
+			continue
+		}
+
+		if loaded {
+			log.Printf("Certificate %s reloaded, expires at %s", l.CertFile, l.NotAfter().Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package common
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fednep/goapilib/config"
+)
+
+func TestTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCert(t, "Test CA", time.Now().AddDate(1, 0, 0), nil)
+	leaf := newTestCert(t, "localhost", time.Now().AddDate(1, 0, 0), ca)
+	certFile, keyFile := writeKeyPair(t, leaf.key, leaf, ca)
+
+	cfg := ServerConfig{
+		Port:      8443,
+		UseTLS:    true,
+		CertFile:  certFile,
+		KeyFile:   keyFile,
+		TLSCurves: config.List{"X25519", "P-256"},
+	}
+
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		t.Fatalf("TLSConfig returned error: %s", err)
+	}
+
+	if tlsConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Expected TLS 1.2 by default, got %x", tlsConfig.MinVersion)
+	}
+
+	if !reflect.DeepEqual(tlsConfig.CurvePreferences, []tls.CurveID{tls.X25519, tls.CurveP256}) {
+		t.Errorf("Invalid curves: %v", tlsConfig.CurvePreferences)
+	}
+
+	if !reflect.DeepEqual(tlsConfig.NextProtos, []string{"h2", "http/1.1"}) {
+		t.Errorf("Expected HTTP/2 to be negotiated, got %v", tlsConfig.NextProtos)
+	}
+
+	cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil || cert == nil || len(cert.Certificate) != 2 {
+		t.Fatalf("Expected certificate chain from GetCertificate, got %v, %v", cert, err)
+	}
+
+	cfg.DisableHTTP2 = true
+	if tlsConfig, _ := cfg.TLSConfig(); !reflect.DeepEqual(tlsConfig.NextProtos, []string{"http/1.1"}) {
+		t.Errorf("Expected only HTTP/1.1, got %v", tlsConfig.NextProtos)
+	}
+
+	cfg.TLSCurves = config.List{"P-999"}
+	if _, err := cfg.TLSConfig(); err == nil {
+		t.Errorf("Expected error for unknown curve")
+	}
+	if path := config.FieldPath(cfg.IsValid()); path != "TLSCurves" {
+		t.Errorf("Expected TLSCurves to be invalid, got %v", cfg.IsValid())
+	}
+
+	cfg.TLSCurves = nil
+	cfg.KeyFile = certFile
+	if _, err := cfg.TLSConfig(); err == nil {
+		t.Errorf("Expected error for invalid key file")
+	}
+}
+
+func TestClientAllowed(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCert(t, "Test CA", time.Now().AddDate(1, 0, 0), nil)
+	billing := newTestCert(t, "billing.internal", time.Now().AddDate(1, 0, 0), ca)
+	selfSigned := newTestCert(t, "billing.internal", time.Now().AddDate(1, 0, 0), nil)
+	other := newTestCert(t, "other.external", time.Now().AddDate(1, 0, 0), ca)
+
+	verify := ServerConfig{ClientAuth: "verify", ClientAllowed: config.List{"*.internal"}}.tlsConfig().VerifyConnection
+
+	tests := []struct {
+		name    string
+		state   tls.ConnectionState
+		allowed bool
+	}{
+		{"verified", tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{billing.cert},
+			VerifiedChains:   [][]*x509.Certificate{{billing.cert, ca.cert}},
+		}, true},
+		{"not allowed", tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{other.cert},
+			VerifiedChains:   [][]*x509.Certificate{{other.cert, ca.cert}},
+		}, false},
+		// Names of the certificates which are not verified are not trusted
+		{"self-signed", tls.ConnectionState{PeerCertificates: []*x509.Certificate{selfSigned.cert}}, false},
+		{"no certificate", tls.ConnectionState{}, false},
+	}
+
+	for _, tt := range tests {
+		if err := verify(tt.state); (err == nil) != tt.allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", tt.name, tt.allowed, err)
+		}
+	}
+}
+
+func TestCertLoaderWatch(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCert(t, "Test CA", time.Now().AddDate(1, 0, 0), nil)
+	first := newTestCert(t, "localhost", time.Now().AddDate(0, 1, 0), ca)
+	second := newTestCert(t, "localhost", time.Now().AddDate(0, 2, 0), ca)
+
+	certFile, keyFile := writeKeyPair(t, first.key, first)
+
+	loader, err := NewCertLoader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertLoader returned error: %s", err)
+	}
+
+	if !loader.NotAfter().Equal(first.cert.NotAfter) {
+		t.Errorf("Expected expiry %s, got %s", first.cert.NotAfter, loader.NotAfter())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go loader.Watch(ctx, 10*time.Millisecond)
+
+	waitFor := func(notAfter time.Time) bool {
+		for i := 0; i < 200; i++ {
+			if loader.NotAfter().Equal(notAfter) {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	// Broken pair is ignored, the first certificate is still served
+	if err := os.WriteFile(certFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	cert, _ := loader.GetCertificate(nil)
+	if cert == nil || !loader.NotAfter().Equal(first.cert.NotAfter) {
+		t.Errorf("Expected the first certificate to be kept")
+	}
+
+	newCert, newKey := writeKeyPair(t, second.key, second)
+	for _, f := range [][2]string{{newKey, keyFile}, {newCert, certFile}} {
+		data, err := os.ReadFile(f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f[1], data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !waitFor(second.cert.NotAfter) {
+		t.Errorf("Expected rotated certificate to be loaded, expiry is %s", loader.NotAfter())
+	}
+}
+
+func TestDisableHTTP2(t *testing.T) {
+	t.Parallel()
+
+	for _, disable := range []bool{false, true} {
+		cfg := ServerConfig{Port: 8443, UseTLS: true, DevTLS: true, DevTLSCacheDir: t.TempDir(), DisableHTTP2: disable}
+
+		tlsConfig, err := cfg.TLSConfig()
+		if err != nil {
+			t.Fatalf("TLSConfig returned error: %s", err)
+		}
+
+		srv := cfg.Server(http.NotFoundHandler())
+		srv.TLSConfig = tlsConfig
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go srv.ServeTLS(ln, "", "")
+
+		// Client which prefers HTTP/2 gets it whenever the server offers it
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"h2"},
+		})
+
+		var proto string
+		if err == nil {
+			proto = conn.ConnectionState().NegotiatedProtocol
+			conn.Close()
+		}
+		srv.Close()
+
+		if disable && proto == "h2" {
+			t.Errorf("HTTP/2 is negotiated with DisableHTTP2")
+		}
+		if !disable && proto != "h2" {
+			t.Errorf("Expected HTTP/2 to be negotiated, got %q, %v", proto, err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fednep/goapilib/config"
+)
+
+// CertExpiryWarning is the period before expiration of the certificate
+// when CheckFiles starts logging warnings about it
+var CertExpiryWarning = 30 * 24 * time.Hour
+
+// validHost reports whether address is empty (all interfaces),
+// an IP address or a valid DNS name
+func validHost(address string) bool {
+	if address == "" || net.ParseIP(address) != nil {
+		return true
+	}
+
+	if len(address) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(strings.TrimSuffix(address, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, c := range label {
+			isAlnum := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+			if !isAlnum && c != '-' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// checkKeyPair verifies that certificate and key files can be read,
+// the key matches the certificate, every certificate in the file is
+// signed by the next one and all of them are valid at the moment now
+func checkKeyPair(certFile, keyFile string, now time.Time) error {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return config.FieldError{FieldName: "CertFile", Message: fmt.Sprintf("cannot read: %s", err)}
+	}
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return config.FieldError{FieldName: "KeyFile", Message: fmt.Sprintf("cannot read: %s", err)}
+	}
+
+	chain, err := parseCertificates(certPEM)
+	if err != nil {
+		return config.FieldError{FieldName: "CertFile", Message: err.Error()}
+	}
+
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return config.FieldError{FieldName: "KeyFile", Message: fmt.Sprintf("invalid key pair: %s", err)}
+	}
+
+	for i, cert := range chain {
+		name := cert.Subject.String()
+
+		if now.Before(cert.NotBefore) {
+			return config.FieldError{
+				FieldName: "CertFile",
+				Message:   fmt.Sprintf("certificate %q is not valid before %s", name, cert.NotBefore.Format(time.RFC3339))}
+		}
+
+		if now.After(cert.NotAfter) {
+			return config.FieldError{
+				FieldName: "CertFile",
+				Message:   fmt.Sprintf("certificate %q expired at %s", name, cert.NotAfter.Format(time.RFC3339))}
+		}
+
+		if cert.NotAfter.Sub(now) < CertExpiryWarning {
+			log.Printf("WARNING: certificate %q in %s expires at %s", name, certFile, cert.NotAfter.Format(time.RFC3339))
+		}
+
+		if i+1 < len(chain) {
+			if err := cert.CheckSignatureFrom(chain[i+1]); err != nil {
+				return config.FieldError{
+					FieldName: "CertFile",
+					Message:   fmt.Sprintf("certificate %q is not signed by %q: %s", name, chain[i+1].Subject, err)}
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+
+	return chain, nil
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsVersion returns TLS version by name, TLS 1.2 if name is empty
+func tlsVersion(name string) (uint16, error) {
+	if name == "" {
+		return tls.VersionTLS12, nil
+	}
+
+	v, ok := tlsVersions[strings.TrimPrefix(name, "TLS")]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", name)
+	}
+	return v, nil
+}
+
+// cipherSuites returns IDs of the secure cipher suites by names
+func cipherSuites(names []string) ([]uint16, error) {
+	var ids []uint16
+
+	for _, name := range names {
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, cs := range tls.CipherSuites() {
+		if cs.Name == name {
+			return cs.ID, true
+		}
+	}
+	return 0, false
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                tls.NoClientCert,
+	"request":         tls.RequestClientCert,
+	"require":         tls.RequireAnyClientCert,
+	"verify-if-given": tls.VerifyClientCertIfGiven,
+	"verify":          tls.RequireAndVerifyClientCert,
+}
+
+func clientAuthType(name string) (tls.ClientAuthType, error) {
+	t, ok := clientAuthTypes[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown client auth mode %q, expected request, require, verify-if-given or verify", name)
+	}
+	return t, nil
+}
+
+func loadCertPool(fn string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read: %w", err)
+	}
+
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
+
+// checkClientAllowed returns error if none of the names of the client
+// certificate match any of the patterns
+func checkClientAllowed(cert *x509.Certificate, patterns []string) error {
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok && name != "" {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("client %q is not allowed", cert.Subject.CommonName)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 type FieldError struct {
@@ -15,6 +16,41 @@ func (e FieldError) Error() string {
 	return fmt.Sprintf("field %q: %s", e.FieldName, e.Message)
 }
 
+// SectionError wraps error returned by validation of the nested section
+// by IsValid
+type SectionError struct {
+	Section string
+	Err     error
+}
+
+func (e SectionError) Error() string {
+	return fmt.Sprintf("[%s] %s", e.Section, e.Err)
+}
+
+func (e SectionError) Unwrap() error {
+	return e.Err
+}
+
+// FieldPath returns dotted path of the field which failed validation,
+// for example "Server.Port", or empty string if err is not a FieldError
+// returned by IsValid.
+func FieldPath(err error) string {
+	var path []string
+
+	for err != nil {
+		switch e := err.(type) {
+		case SectionError:
+			path = append(path, e.Section)
+		case FieldError:
+			return strings.Join(append(path, e.FieldName), ".")
+		}
+
+		err = errors.Unwrap(err)
+	}
+
+	return ""
+}
+
 // Section defines interface used by configuration sections
 type Section interface {
 	IsValid() error
@@ -57,7 +93,7 @@ func validate(st reflect.Value) error {
 		if kind == reflect.Struct {
 			err := validate(f)
 			if err != nil {
-				return fmt.Errorf("[%s] %w", tf.Name, err)
+				return SectionError{Section: tf.Name, Err: err}
 			}
 		}
 	}
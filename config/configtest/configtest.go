@@ -0,0 +1,128 @@
+// Package configtest provides helpers to test loading and validation of
+// configuration without touching the environment of the process, so tests
+// using it can run in parallel.
+package configtest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fednep/goapilib/config"
+)
+
+// UpdateEnv is the name of environment variable which makes GoldenDocs
+// rewrite golden files instead of comparing with them:
+//
+//	UPDATE_GOLDEN=1 go test ./...
+const UpdateEnv = "UPDATE_GOLDEN"
+
+// FromEnv loads configuration of type T from env map the same way as
+// config.LoadOverrides loads it from the environment variables.
+// Configuration is not validated.
+func FromEnv[T any](t testing.TB, env map[string]string) T {
+	t.Helper()
+
+	var cfg T
+	if err := config.LoadFrom(&cfg, config.MapSource(env)); err != nil {
+		t.Fatalf("Cannot load config from env: %s", err)
+	}
+
+	return cfg
+}
+
+// FromToml loads configuration of type T from TOML text.
+// Configuration is not validated.
+func FromToml[T any](t testing.TB, data string) T {
+	t.Helper()
+
+	var cfg T
+	if err := config.LoadToml(&cfg, writeTemp(t, "config.toml", data)); err != nil {
+		t.Fatalf("Cannot load config from TOML: %s", err)
+	}
+
+	return cfg
+}
+
+// FromEnvFile loads configuration of type T from .env file text.
+// Configuration is not validated.
+func FromEnvFile[T any](t testing.TB, data string) T {
+	t.Helper()
+
+	src, err := config.EnvFileSource(writeTemp(t, ".env", data))
+	if err != nil {
+		t.Fatalf("Cannot read .env file: %s", err)
+	}
+
+	var cfg T
+	if err := config.LoadFrom(&cfg, src); err != nil {
+		t.Fatalf("Cannot load config from .env file: %s", err)
+	}
+
+	return cfg
+}
+
+func writeTemp(t testing.TB, name string, data string) string {
+	t.Helper()
+
+	fn := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(fn, []byte(data), 0o600); err != nil {
+		t.Fatalf("Cannot write %q: %s", fn, err)
+	}
+
+	return fn
+}
+
+// AssertValid fails the test if configuration is not valid
+func AssertValid(t testing.TB, cfg any) {
+	t.Helper()
+
+	if err := config.IsValid(cfg); err != nil {
+		t.Fatalf("Config is not valid: %s", err)
+	}
+}
+
+// AssertInvalid fails the test unless validation of the configuration
+// fails for the field with the dotted path, for example "Server.Port"
+func AssertInvalid(t testing.TB, cfg any, path string) {
+	t.Helper()
+
+	err := config.IsValid(cfg)
+	if err == nil {
+		t.Fatalf("Config is valid, expected validation error for %q", path)
+	}
+
+	if got := config.FieldPath(err); got != path {
+		t.Fatalf("Validation failed for %q, expected %q: %s", got, path, err)
+	}
+}
+
+// GoldenDocs compares documentation generated by config.WriteDocs with
+// the golden file. If UPDATE_GOLDEN environment variable is set, the
+// golden file is written instead.
+func GoldenDocs(t testing.TB, cfg any, golden string) {
+	t.Helper()
+
+	buf := bytes.Buffer{}
+	if err := config.WriteDocs(&buf, cfg); err != nil {
+		t.Fatalf("Cannot generate docs: %s", err)
+	}
+
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatalf("Cannot update golden file: %s", err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Cannot read golden file (run with %s=1 to create it): %s", UpdateEnv, err)
+	}
+
+	if !bytes.Equal(expected, buf.Bytes()) {
+		t.Fatalf("Docs differ from %q (run with %s=1 to update).\nGot:\n%s\nExpected:\n%s",
+			golden, UpdateEnv, buf.String(), string(expected))
+	}
+}
@@ -0,0 +1,82 @@
+package configtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fednep/goapilib/config"
+	"github.com/fednep/goapilib/config/common"
+)
+
+type testConfig struct {
+	Name     string              `env:"NAME" desc:"Name of the service"`
+	Password string              `env:"DB_PASSWORD" secret:"true" desc:"Database password"`
+	Server   common.ServerConfig `env:"SERVER" toml:"server"`
+}
+
+func TestLoaders(t *testing.T) {
+	t.Parallel()
+
+	fromEnv := FromEnv[testConfig](t, map[string]string{
+		"NAME":                    "service",
+		"SERVER_HTTP_PORT":        "8080",
+		"SERVER_HTTP_TIMEOUT":     "1m",
+		"NAME_NOT_USED_BY_CONFIG": "value",
+	})
+
+	fromToml := FromToml[testConfig](t, `
+name = "service"
+
+[server]
+port = 8080
+timeout = "1m"
+`)
+
+	fromEnvFile := FromEnvFile[testConfig](t, `
+# comment
+NAME=service
+SERVER_HTTP_PORT=8080
+SERVER_HTTP_TIMEOUT="1m"
+`)
+
+	for _, cfg := range []testConfig{fromToml, fromEnvFile} {
+		if changes, _ := config.Diff(fromEnv, cfg); len(changes) > 0 {
+			t.Errorf("Configs are different: %v", changes)
+		}
+	}
+
+	AssertValid(t, fromEnv)
+}
+
+func TestAssertInvalid(t *testing.T) {
+	t.Parallel()
+
+	cfg := FromEnv[testConfig](t, map[string]string{
+		"SERVER_HTTP_PORT":    "8443",
+		"SERVER_HTTP_USE_TLS": "true",
+	})
+
+	AssertInvalid(t, cfg, "Server.CertFile")
+}
+
+type docsSection struct {
+	Port    int             `env:"PORT" toml:"port" desc:"Port to listen on"`
+	Timeout config.Duration `env:"TIMEOUT" desc:"Request timeout"`
+}
+
+type docsConfig struct {
+	Name     string            `env:"NAME" desc:"Name of the service"`
+	Password string            `env:"DB_PASSWORD" secret:"true" desc:"Database password"`
+	Labels   map[string]string `env:"LABELS,prefix"`
+	Server   docsSection       `env:"SERVER" toml:"server"`
+}
+
+func TestGoldenDocs(t *testing.T) {
+	t.Parallel()
+
+	defaults := docsConfig{Password: "secret"}
+	defaults.Server.Port = 8080
+	defaults.Server.Timeout = config.Duration(30 * time.Second)
+
+	GoldenDocs(t, defaults, "testdata/docs.md")
+}
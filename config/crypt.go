@@ -0,0 +1,202 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// EncryptedPrefix is a prefix of values encrypted with Encrypt
+const EncryptedPrefix = "enc:v1:"
+
+// Names of environment variables with the encryption keys.
+//
+// KeyEnv contains base64 encoded 32 byte AES key, or several keys separated
+// by commas. KeyFileEnv contains path to the file with keys, one per line.
+// The first key is used for encryption, all of them are tried for decryption,
+// which allows to rotate keys.
+const (
+	KeyEnv     = "CONFIG_KEY"
+	KeyFileEnv = "CONFIG_KEY_FILE"
+)
+
+// ErrNoKey is returned when encrypted value is found,
+// but no encryption key is configured
+var ErrNoKey = errors.New("encryption key is not configured")
+
+// GenerateKey returns new random key encoded with base64
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKeys parses base64 encoded keys separated by commas or new lines.
+// Empty lines and lines starting with # are ignored.
+func ParseKeys(s string) ([][]byte, error) {
+	var keys [][]byte
+
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	})
+
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		if f == "" || strings.HasPrefix(f, "#") {
+			continue
+		}
+
+		key, err := base64.StdEncoding.DecodeString(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key: %w", err)
+		}
+
+		if len(key) != 32 {
+			return nil, fmt.Errorf("invalid key length %d, expected 32 bytes", len(key))
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// LoadKeys loads encryption keys from KeyEnv variable or from the file
+// specified by KeyFileEnv variable. Returns ErrNoKey if none of them is set.
+func LoadKeys() ([][]byte, error) {
+	if val, ok := os.LookupEnv(KeyEnv); ok && val != "" {
+		return ParseKeys(val)
+	}
+
+	if fn, ok := os.LookupEnv(KeyFileEnv); ok && fn != "" {
+		return LoadKeyFile(fn)
+	}
+
+	return nil, ErrNoKey
+}
+
+// LoadKeyFile loads encryption keys from the file, one per line
+func LoadKeyFile(fn string) ([][]byte, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read key file: %w", err)
+	}
+
+	keys, err := ParseKeys(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrNoKey
+	}
+
+	return keys, nil
+}
+
+// IsEncrypted reports whether value is encrypted with Encrypt
+func IsEncrypted(val string) bool {
+	return strings.HasPrefix(val, EncryptedPrefix)
+}
+
+// Encrypt encrypts value with AES-GCM and returns it in the form
+// enc:v1:<base64>, which can be stored in TOML or .env file.
+//
+// name is the key the value is stored under: dotted TOML key, for example
+// "database.password", or the name of the variable for env sources. It is
+// authenticated together with the value, so the value can't be decrypted
+// when moved to another key. Names are compared case insensitively.
+func Encrypt(val string, name string, key []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	data := gcm.Seal(nonce, nonce, []byte(val), additionalData(name))
+	return EncryptedPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decrypt decrypts value encrypted with Encrypt for the name.
+// Every key is tried until one of them succeeds.
+func Decrypt(val string, name string, keys ...[]byte) (string, error) {
+	if !IsEncrypted(val) {
+		return "", errors.New("value is not encrypted")
+	}
+
+	if len(keys) == 0 {
+		return "", ErrNoKey
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(val, EncryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+
+	for _, key := range keys {
+		gcm, err := newGCM(key)
+		if err != nil {
+			return "", err
+		}
+
+		if len(data) < gcm.NonceSize() {
+			return "", errors.New("invalid encrypted value: too short")
+		}
+
+		nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+		res, err := gcm.Open(nil, nonce, ciphertext, additionalData(name))
+		if err == nil {
+			return string(res), nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot decrypt value of %q with any of the keys", name)
+}
+
+// additionalData returns name of the value authenticated by AES-GCM
+func additionalData(name string) []byte {
+	return []byte(strings.ToLower(name))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// decryptValue decrypts value using keys from LoadKeys. Value can be
+// encrypted for any of the names.
+func decryptValue(val string, names []string) (string, error) {
+	keys, err := LoadKeys()
+	if err != nil {
+		return "", err
+	}
+
+	if len(names) == 0 {
+		return "", errors.New("encrypted value is not stored under any key")
+	}
+
+	for _, name := range names {
+		if res, err := Decrypt(val, name, keys...); err == nil {
+			return res, nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot decrypt value of %q with any of the keys", strings.Join(names, `" or "`))
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	oldKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := ParseKeys(newKey + "," + oldKey)
+	if err != nil {
+		t.Fatalf("ParseKeys returned error: %s", err)
+	}
+
+	enc, err := Encrypt("db-password", "database.password", keys[1])
+	if err != nil {
+		t.Fatalf("Encrypt returned error: %s", err)
+	}
+
+	if !IsEncrypted(enc) {
+		t.Fatalf("Encrypted value %q doesn't have prefix", enc)
+	}
+
+	// Value encrypted with the old key is decrypted during rotation
+	if val, err := Decrypt(enc, "Database.Password", keys...); err != nil || val != "db-password" {
+		t.Fatalf("Decrypt returned %q, %v", val, err)
+	}
+
+	if _, err := Decrypt(enc, "database.password", keys[0]); err == nil {
+		t.Fatalf("Expected error decrypting with the wrong key")
+	}
+
+	// Value is bound to the key it is encrypted for
+	if _, err := Decrypt(enc, "database.user", keys...); err == nil {
+		t.Fatalf("Expected error decrypting value moved to another key")
+	}
+}
+
+func TestResolveEncrypted(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := ParseKeys(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypt := func(val, name string) string {
+		enc, err := Encrypt(val, name, keys[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return enc
+	}
+
+	type Database struct {
+		User     string `toml:"user" env:"USER"`
+		Password string `toml:"password" env:"PASSWORD,alias=PASS"`
+	}
+
+	type MyStruct struct {
+		Database Database          `toml:"db" env:"DB"`
+		Labels   map[string]string `env:"LABELS,prefix"`
+		Token    string            `toml:"-" env:"TOKEN"`
+	}
+
+	os.Setenv(KeyEnv, key)
+	defer os.Unsetenv(KeyEnv)
+
+	s := MyStruct{
+		Database: Database{User: encrypt("admin", "db.user"), Password: encrypt("db-password", "DB_PASS")},
+		Labels:   map[string]string{"team": encrypt("core", "labels.team"), "tier": encrypt("gold", "LABELS_tier")},
+		Token:    encrypt("token", "TOKEN"),
+	}
+
+	if err := ResolveSecrets(context.Background(), &s); err != nil {
+		t.Fatalf("ResolveSecrets returned error: %s", err)
+	}
+
+	expected := MyStruct{
+		Database: Database{User: "admin", Password: "db-password"},
+		Labels:   map[string]string{"team": "core", "tier": "gold"},
+		Token:    "token",
+	}
+
+	if !reflect.DeepEqual(s, expected) {
+		t.Errorf("Invalid values decrypted: %+v", s)
+	}
+
+	// Values swapped between the keys are not decrypted
+	s = MyStruct{Database: Database{User: encrypt("db-password", "db.password")}}
+
+	var fieldErr FieldError
+	err = ResolveSecrets(context.Background(), &s)
+	if !errors.As(err, &fieldErr) || fieldErr.FieldName != "Database.User" {
+		t.Errorf("Expected FieldError for Database.User, got: %v", err)
+	}
+
+	s = MyStruct{Token: encrypt("token", "token")}
+	if err := ResolveSecrets(context.Background(), &s); err != nil || s.Token != "token" {
+		t.Errorf("Expected value encrypted for TOKEN variable, got %q, %v", s.Token, err)
+	}
+}
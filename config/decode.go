@@ -0,0 +1,182 @@
+package config
+
+import (
+	"encoding"
+	"flag"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// DecodeFunc converts raw string value from configuration source into
+// the value of a field. Returned value must be assignable (or convertible)
+// to the type of the field.
+type DecodeFunc func(value string) (any, error)
+
+var decoders = struct {
+	sync.RWMutex
+	byType map[reflect.Type]DecodeFunc
+	byName map[string]DecodeFunc
+}{
+	byType: map[reflect.Type]DecodeFunc{},
+	byName: map[string]DecodeFunc{},
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// RegisterDecoder registers decode function used for every field of type t,
+// whichever source (environment, TOML file or command line flag)
+// the value comes from.
+//
+// Useful for types from third-party packages which don't implement
+// encoding.TextUnmarshaler:
+//
+//	config.RegisterDecoder(reflect.TypeOf(money.Amount{}), func(s string) (any, error) {
+//		return money.Parse(s)
+//	})
+func RegisterDecoder(t reflect.Type, fn DecodeFunc) {
+	decoders.Lock()
+	defer decoders.Unlock()
+
+	decoders.byType[t] = fn
+}
+
+// RegisterNamedDecoder registers decode function which is used for fields
+// referring to it with "decoder" tag option:
+//
+//	Ports []int `env:"PORTS,decoder=csvints" toml:"ports,decoder=csvints"`
+func RegisterNamedDecoder(name string, fn DecodeFunc) {
+	decoders.Lock()
+	defer decoders.Unlock()
+
+	decoders.byName[name] = fn
+}
+
+// lookupDecoder returns decoder registered with name, or if name is empty
+// decoder registered for type t. Returns nil if there is no decoder.
+func lookupDecoder(t reflect.Type, name string) (DecodeFunc, error) {
+	decoders.RLock()
+	defer decoders.RUnlock()
+
+	if name != "" {
+		fn, ok := decoders.byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown decoder %q", name)
+		}
+		return fn, nil
+	}
+
+	return decoders.byType[t], nil
+}
+
+// decode converts val into f using decoder registered by name or by
+// the type of the field. Returns false if there is no decoder for the field.
+func decode(f reflect.Value, val string, name string) (bool, error) {
+	fn, err := lookupDecoder(f.Type(), name)
+	if err != nil {
+		return true, err
+	}
+
+	if fn == nil {
+		return false, nil
+	}
+
+	res, err := fn(val)
+	if err != nil {
+		return true, err
+	}
+
+	return true, assign(f, res)
+}
+
+// assign sets f to the value returned by decoder
+func assign(f reflect.Value, res any) error {
+	rv := reflect.ValueOf(res)
+	if !rv.IsValid() {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+
+	switch {
+	case rv.Type().AssignableTo(f.Type()):
+		f.Set(rv)
+	case rv.Type().ConvertibleTo(f.Type()):
+		f.Set(rv.Convert(f.Type()))
+	default:
+		return fmt.Errorf("decoder returned %s, expected %s", rv.Type(), f.Type())
+	}
+
+	return nil
+}
+
+// unmarshalText decodes val using encoding.TextUnmarshaler if the field
+// implements it. Returns false if it is not implemented.
+func unmarshalText(f reflect.Value, val string) (bool, error) {
+	if !f.CanAddr() {
+		return false, nil
+	}
+
+	u, ok := f.Addr().Interface().(encoding.TextUnmarshaler)
+	if !ok {
+		return false, nil
+	}
+
+	return true, u.UnmarshalText([]byte(val))
+}
+
+// decodeString converts val into f the same way as LoadOverrides does,
+// except that values which cannot be parsed are reported as errors.
+func decodeString(f reflect.Value, val string, name string) error {
+	ok, err := decode(f, val, name)
+	if ok {
+		return err
+	}
+
+	ok, err = unmarshalText(f, val)
+	if ok {
+		return err
+	}
+
+	if f.Kind() == reflect.Pointer {
+		newVal := reflect.New(f.Type().Elem())
+		if err := decodeString(newVal.Elem(), val, name); err != nil {
+			return err
+		}
+		f.Set(newVal)
+		return nil
+	}
+
+	return setValue(f, val)
+}
+
+// flagValue adapts configuration field to flag.Value interface
+type flagValue struct {
+	v       reflect.Value
+	decoder string
+}
+
+func (fv flagValue) String() string {
+	if !fv.v.IsValid() {
+		return ""
+	}
+
+	return fmt.Sprint(fv.v.Interface())
+}
+
+func (fv flagValue) Set(s string) error {
+	return decodeString(fv.v, s, fv.decoder)
+}
+
+// FlagVar defines a flag with specified name and usage which sets the value
+// ptr points to. Value is decoded the same way as by LoadOverrides, so
+// registered decoders are applied to command line arguments as well.
+//
+// decoder is an optional name of decoder registered with RegisterNamedDecoder.
+func FlagVar(fs *flag.FlagSet, ptr any, name, usage string, decoder string) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		panic("config: FlagVar requires a non-nil pointer")
+	}
+
+	fs.Var(flagValue{v: v.Elem(), decoder: decoder}, name, usage)
+}
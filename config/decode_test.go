@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// amount stands for a third-party type which doesn't implement
+// encoding.TextUnmarshaler
+type amount struct {
+	Cents int64
+}
+
+func parseAmount(s string) (any, error) {
+	units, cents, _ := strings.Cut(s, ".")
+	u, err := strconv.ParseInt(units, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid amount")
+	}
+
+	c, _ := strconv.ParseInt(cents, 10, 64)
+	return amount{Cents: u*100 + c}, nil
+}
+
+func parseCSVInts(s string) (any, error) {
+	res := []int{}
+	for _, p := range strings.Split(s, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, i)
+	}
+	return res, nil
+}
+
+func init() {
+	RegisterDecoder(reflect.TypeOf(amount{}), parseAmount)
+	RegisterNamedDecoder("csvints", parseCSVInts)
+}
+
+type decodedConfig struct {
+	Price    amount  `env:"DEC_PRICE"`
+	MaxPrice *amount `env:"DEC_MAX_PRICE"`
+	Ports    []int   `env:"DEC_PORTS,decoder=csvints" toml:",decoder=csvints"`
+}
+
+func checkDecoded(t *testing.T, cfg decodedConfig) {
+	t.Helper()
+
+	if cfg.Price.Cents != 1250 {
+		t.Errorf("cfg.Price(%v) contain invalid value. Expected: 1250", cfg.Price)
+	}
+
+	if cfg.MaxPrice == nil || cfg.MaxPrice.Cents != 9900 {
+		t.Errorf("cfg.MaxPrice(%v) contain invalid value. Expected: 9900", cfg.MaxPrice)
+	}
+
+	if !reflect.DeepEqual(cfg.Ports, []int{80, 443}) {
+		t.Errorf("cfg.Ports(%v) contain invalid value. Expected: [80 443]", cfg.Ports)
+	}
+}
+
+func TestDecodersFromEnv(t *testing.T) {
+	os.Setenv("DEC_PRICE", "12.50")
+	os.Setenv("DEC_MAX_PRICE", "99")
+	os.Setenv("DEC_PORTS", "80, 443")
+	defer func() {
+		os.Unsetenv("DEC_PRICE")
+		os.Unsetenv("DEC_MAX_PRICE")
+		os.Unsetenv("DEC_PORTS")
+	}()
+
+	cfg := decodedConfig{}
+	if err := LoadOverrides(&cfg); err != nil {
+		t.Fatalf("LoadOverrides returned error: %s", err)
+	}
+
+	checkDecoded(t, cfg)
+
+	os.Setenv("DEC_PRICE", "invalid")
+	if err := LoadOverrides(&cfg); err == nil {
+		t.Fatalf("Expected error for invalid value")
+	}
+}
+
+func TestDecodersFromToml(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "config.toml")
+	data := "Price = \"12.50\"\nMaxPrice = 99\nPorts = \"80,443\"\n"
+	if err := os.WriteFile(fn, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := decodedConfig{}
+	if err := LoadToml(&cfg, fn); err != nil {
+		t.Fatalf("LoadToml returned error: %s", err)
+	}
+
+	checkDecoded(t, cfg)
+}
+
+func TestDecodersFromFlags(t *testing.T) {
+	cfg := decodedConfig{}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	FlagVar(fs, &cfg.Price, "price", "", "")
+	FlagVar(fs, &cfg.MaxPrice, "max-price", "", "")
+	FlagVar(fs, &cfg.Ports, "ports", "", "csvints")
+
+	err := fs.Parse([]string{"-price", "12.50", "-max-price", "99", "-ports", "80,443"})
+	if err != nil {
+		t.Fatalf("Parse returned error: %s", err)
+	}
+
+	checkDecoded(t, cfg)
+}
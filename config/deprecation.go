@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Deprecation describes usage of a deprecated configuration key
+type Deprecation struct {
+	// Source is either "env" or "toml"
+	Source string
+
+	// Name of the deprecated key which was found in the configuration
+	Name string
+
+	// Replacement is the name which should be used instead
+	Replacement string
+
+	// FatalSince is a version since which using the deprecated key
+	// is an error. Empty if it is always a warning.
+	FatalSince string
+}
+
+func (d Deprecation) String() string {
+	msg := fmt.Sprintf("deprecated %s key %q is used, use %q instead", d.Source, d.Name, d.Replacement)
+	if d.FatalSince != "" {
+		msg += fmt.Sprintf(" (not supported since %s)", d.FatalSince)
+	}
+	return msg
+}
+
+// DeprecationError is returned when deprecated key is used and
+// Version is equal or later than the version specified in the tag
+type DeprecationError struct {
+	Deprecation
+	Version string
+}
+
+func (e DeprecationError) Error() string {
+	return fmt.Sprintf("%s key %q is not supported since %s (current version %s), use %q instead",
+		e.Source, e.Name, e.FatalSince, e.Version, e.Replacement)
+}
+
+// Version is the version of the application which loads the configuration.
+// When it is set, using deprecated keys marked with version
+// (`env:"NEW,deprecated=OLD@2.0"`) becomes an error since that version.
+var Version string
+
+// OnDeprecation is called for every deprecated key found in the
+// configuration. By default warning is written to the log.
+var OnDeprecation = func(d Deprecation) {
+	log.Printf("Warning: %s", d)
+}
+
+// altName is an alternative name of configuration key
+// specified with "alias" or "deprecated" tag options
+type altName struct {
+	name       string
+	deprecated bool
+	fatalSince string
+}
+
+// alternatives returns alternative names of the key. Names are
+// separated with "|":
+//
+//	`env:"HTTP_PORT,alias=PORT|LISTEN_PORT,deprecated=SERVER_PORT@2.0"`
+func alternatives(opts tagOptions) []altName {
+	var res []altName
+
+	for _, name := range strings.Split(opts.Get("alias"), "|") {
+		if name != "" {
+			res = append(res, altName{name: name})
+		}
+	}
+
+	for _, name := range strings.Split(opts.Get("deprecated"), "|") {
+		if name == "" {
+			continue
+		}
+
+		name, since, _ := strings.Cut(name, "@")
+		res = append(res, altName{name: name, deprecated: true, fatalSince: since})
+	}
+
+	return res
+}
+
+// deprecated reports usage of the deprecated key and returns an error
+// if it is not supported by the current Version
+func deprecated(d Deprecation) error {
+	if d.FatalSince != "" && Version != "" && compareVersions(Version, d.FatalSince) >= 0 {
+		return DeprecationError{Deprecation: d, Version: Version}
+	}
+
+	if OnDeprecation != nil {
+		OnDeprecation(d)
+	}
+
+	return nil
+}
+
+// compareVersions compares dot-separated versions like "v1.2.3"
+// numerically. Pre-release suffixes ("-rc1") are ignored.
+func compareVersions(a, b string) int {
+	pa := versionParts(a)
+	pb := versionParts(b)
+
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na = pa[i]
+		}
+		if i < len(pb) {
+			nb = pb[i]
+		}
+
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func versionParts(v string) []int {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, _, _ = strings.Cut(v, "-")
+	v, _, _ = strings.Cut(v, "+")
+
+	var res []int
+	for _, p := range strings.Split(v, ".") {
+		n, _ := strconv.Atoi(p)
+		res = append(res, n)
+	}
+
+	return res
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type renamedSection struct {
+	Port int `toml:"port,deprecated=http_port@2.0"`
+}
+
+type renamedConfig struct {
+	Address string         `env:"REN_ADDRESS,alias=REN_ADDR" toml:"address,alias=addr"`
+	Port    int            `env:"REN_PORT,deprecated=REN_HTTP_PORT@2.0"`
+	Server  renamedSection `toml:"server"`
+}
+
+func captureDeprecations(t *testing.T) *[]Deprecation {
+	var res []Deprecation
+
+	handler, version := OnDeprecation, Version
+	t.Cleanup(func() {
+		OnDeprecation, Version = handler, version
+	})
+
+	OnDeprecation = func(d Deprecation) {
+		res = append(res, d)
+	}
+
+	return &res
+}
+
+func TestDeprecatedEnv(t *testing.T) {
+	deps := captureDeprecations(t)
+
+	os.Setenv("REN_ADDR", "127.0.0.1")
+	os.Setenv("REN_HTTP_PORT", "8080")
+	defer func() {
+		os.Unsetenv("REN_ADDR")
+		os.Unsetenv("REN_HTTP_PORT")
+		os.Unsetenv("REN_PORT")
+	}()
+
+	cfg := renamedConfig{}
+	if err := LoadOverrides(&cfg); err != nil {
+		t.Fatalf("LoadOverrides returned error: %s", err)
+	}
+
+	if cfg.Address != "127.0.0.1" || cfg.Port != 8080 {
+		t.Errorf("Invalid values loaded from aliases: %+v", cfg)
+	}
+
+	if len(*deps) != 1 || (*deps)[0].Name != "REN_HTTP_PORT" || (*deps)[0].Replacement != "REN_PORT" {
+		t.Errorf("Unexpected deprecation warnings: %v", *deps)
+	}
+
+	// Same value for old and new names is accepted
+	os.Setenv("REN_PORT", "8080")
+	if err := LoadOverrides(&cfg); err != nil {
+		t.Fatalf("LoadOverrides returned error: %s", err)
+	}
+
+	os.Setenv("REN_PORT", "9090")
+	if err := LoadOverrides(&cfg); err == nil {
+		t.Fatalf("Expected error when old and new names have different values")
+	}
+
+	os.Unsetenv("REN_PORT")
+	Version = "v2.0.1"
+	if err := LoadOverrides(&cfg); err == nil {
+		t.Fatalf("Expected deprecation error since version 2.0")
+	}
+}
+
+func TestDeprecatedToml(t *testing.T) {
+	deps := captureDeprecations(t)
+
+	fn := filepath.Join(t.TempDir(), "config.toml")
+	data := "addr = \"127.0.0.1\"\n[server]\nhttp_port = 8080\n"
+	if err := os.WriteFile(fn, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := renamedConfig{}
+	if err := LoadToml(&cfg, fn); err != nil {
+		t.Fatalf("LoadToml returned error: %s", err)
+	}
+
+	if cfg.Address != "127.0.0.1" || cfg.Server.Port != 8080 {
+		t.Errorf("Invalid values loaded from aliases: %+v", cfg)
+	}
+
+	if len(*deps) != 1 || (*deps)[0].Name != "server.http_port" || (*deps)[0].Replacement != "server.port" {
+		t.Errorf("Unexpected deprecation warnings: %v", *deps)
+	}
+
+	data = "address = \"10.0.0.1\"\naddr = \"127.0.0.1\"\n"
+	if err := os.WriteFile(fn, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadToml(&cfg, fn); err == nil {
+		t.Fatalf("Expected error when old and new keys have different values")
+	}
+
+	Version = "2.0"
+	data = "[server]\nhttp_port = 8080\n"
+	if err := os.WriteFile(fn, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadToml(&cfg, fn); err == nil {
+		t.Fatalf("Expected deprecation error since version 2.0")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		res  int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.10", "1.9", 1},
+		{"2.0", "2.0.0", 0},
+		{"1.9.9", "2.0", -1},
+		{"2.0.0-rc1", "2.0", 0},
+	}
+
+	for _, c := range testCases {
+		if res := compareVersions(c.a, c.b); res != c.res {
+			t.Errorf("compareVersions(%q, %q) = %d, expected %d", c.a, c.b, res, c.res)
+		}
+	}
+}
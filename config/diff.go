@@ -0,0 +1,154 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Mask replaces values of the secret fields in Diff and Export output.
+//
+// Fields are marked as secret with the struct tag:
+//
+//	Password string `env:"DB_PASSWORD" secret:"true"`
+const Mask = "******"
+
+func isSecretField(tf reflect.StructField) bool {
+	return tf.Tag.Get("secret") == "true"
+}
+
+// Change describes difference of a single field between two configurations
+type Change struct {
+	// Path of the field, for example "Server.Port"
+	Path string
+
+	// Old and New are the values in human-friendly form, or Mask for
+	// the secret fields
+	Old string
+	New string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, c.Old, c.New)
+}
+
+// Diff compares two configuration structs of the same type field by field
+// and returns the changed fields. Values of the fields marked as secret
+// are masked.
+func Diff(a, b any) ([]Change, error) {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if !va.IsValid() || !vb.IsValid() || va.Type() != vb.Type() {
+		return nil, errors.New("configs should be of the same type")
+	}
+
+	for va.Kind() == reflect.Pointer {
+		if va.IsNil() || vb.IsNil() {
+			return nil, errors.New("config is nil")
+		}
+		va, vb = va.Elem(), vb.Elem()
+	}
+
+	if va.Kind() != reflect.Struct {
+		return nil, errors.New("not a struct")
+	}
+
+	var changes []Change
+	diffValues("", va, vb, false, &changes)
+	return changes, nil
+}
+
+func diffValues(path string, a, b reflect.Value, secret bool, changes *[]Change) {
+
+	// Map entry exists only in one of the configs, it's reported as
+	// a whole
+	if !a.IsValid() || !b.IsValid() {
+		if a.IsValid() != b.IsValid() {
+			addChange(path, a, b, secret, changes)
+		}
+		return
+	}
+
+	if a.Kind() == reflect.Pointer && !a.IsNil() && !b.IsNil() {
+		diffValues(path, a.Elem(), b.Elem(), secret, changes)
+		return
+	}
+
+	// Structs implementing fmt.Stringer (like time.Time) are compared
+	// as single values
+	if a.Kind() == reflect.Struct && !isStringer(a) {
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			tf := t.Field(i)
+			if tf.PkgPath != "" {
+				continue
+			}
+
+			diffValues(joinPath(path, tf.Name), a.Field(i), b.Field(i),
+				secret || isSecretField(tf), changes)
+		}
+		return
+	}
+
+	if a.Kind() == reflect.Map && a.Type().Key().Kind() == reflect.String {
+		keys := map[string]bool{}
+		for _, k := range a.MapKeys() {
+			keys[k.String()] = true
+		}
+		for _, k := range b.MapKeys() {
+			keys[k.String()] = true
+		}
+
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		for _, k := range sorted {
+			key := reflect.ValueOf(k).Convert(a.Type().Key())
+			diffValues(fmt.Sprintf("%s[%s]", path, k), a.MapIndex(key), b.MapIndex(key), secret, changes)
+		}
+		return
+	}
+
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return
+	}
+
+	addChange(path, a, b, secret, changes)
+}
+
+func addChange(path string, a, b reflect.Value, secret bool, changes *[]Change) {
+	c := Change{Path: path, Old: formatValue(a), New: formatValue(b)}
+	if secret {
+		c.Old, c.New = Mask, Mask
+	}
+
+	*changes = append(*changes, c)
+}
+
+func isStringer(v reflect.Value) bool {
+	_, ok := v.Interface().(fmt.Stringer)
+	return ok
+}
+
+// formatValue returns value in human-friendly form
+func formatValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return "<none>"
+	}
+
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "<nil>"
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.String {
+		return fmt.Sprintf("%q", v.String())
+	}
+
+	return fmt.Sprintf("%v", v.Interface())
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// CredentialsDirEnv is set by systemd to the directory
+// with credentials specified by LoadCredential= and similar options
+const CredentialsDirEnv = "CREDENTIALS_DIRECTORY"
+
+// readDir reads all regular files in the directory. Hidden files are
+// skipped: Kubernetes keeps previous versions of the mounted ConfigMaps
+// and Secrets in "..<timestamp>" directories and swaps "..data" symlink.
+//
+// Trailing new line is removed from the values.
+func readDir(dir string) (MapSource, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	src := MapSource{}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		fn := filepath.Join(dir, e.Name())
+
+		// Stat follows symlinks, which are used for every file
+		// in Kubernetes volumes
+		st, err := os.Stat(fn)
+		if err != nil {
+			return nil, err
+		}
+
+		if !st.Mode().IsRegular() {
+			continue
+		}
+
+		data, err := os.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+
+		src[e.Name()] = strings.TrimRight(string(data), "\r\n")
+	}
+
+	return src, nil
+}
+
+// DirSource returns source with the values read from the directory
+// where each file holds one value. See LoadDir.
+func DirSource(dir string) (MapSource, error) {
+	src, err := readDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config directory: %w", err)
+	}
+
+	return src, nil
+}
+
+// LoadDir loads data into struct from the directory where each file holds
+// one value, for example Kubernetes ConfigMap or Secret volume.
+//
+// File names are matched with the names from "env" struct tags, the same
+// way as LoadOverrides does with environment variables, including prefixes
+// of the nested sections:
+//
+//	/etc/service/HTTP_PORT         -> Port int `env:"HTTP_PORT"`
+//	/etc/service/SERVICE_HTTP_PORT -> the same field in the section
+//	                                  with `env:"SERVICE"` tag
+func LoadDir(cfg any, dir string) error {
+	src, err := DirSource(dir)
+	if err != nil {
+		return err
+	}
+
+	return LoadFrom(cfg, src)
+}
+
+// CredentialsDir returns the directory with systemd credentials
+// or empty string if the service is not started by systemd with credentials
+func CredentialsDir() string {
+	return os.Getenv(CredentialsDirEnv)
+}
+
+// LoadCredentials loads data into struct from systemd credentials directory
+// (see LoadDir). Does nothing if the credentials directory is not set.
+func LoadCredentials(cfg any) error {
+	dir := CredentialsDir()
+	if dir == "" {
+		return nil
+	}
+
+	return LoadDir(cfg, dir)
+}
+
+// DefaultWatchInterval is used by WatchDir when interval is not positive
+const DefaultWatchInterval = 10 * time.Second
+
+// WatchDir polls the directory every interval (DefaultWatchInterval if
+// zero or negative) and calls onChange when any of the values are changed,
+// added or removed. Atomic swaps of the files (as done by Kubernetes) are
+// detected as well.
+//
+// Blocks until the context is cancelled. Errors reading the directory
+// are ignored, as it can be in the middle of update.
+func WatchDir(ctx context.Context, dir string, interval time.Duration, onChange func()) error {
+	prev, err := readDir(dir)
+	if err != nil {
+		return fmt.Errorf("cannot read config directory: %w", err)
+	}
+
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-ticker.C:
+			cur, err := readDir(dir)
+			if err != nil {
+				continue
+			}
+
+			if !reflect.DeepEqual(prev, cur) {
+				prev = cur
+				onChange()
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type dirSection struct {
+	Port int `env:"HTTP_PORT"`
+}
+
+type dirConfig struct {
+	Password string     `env:"DB_PASSWORD"`
+	Server   dirSection `env:"SERVICE"`
+}
+
+// writeVersion emulates Kubernetes volume update: files are written into
+// a new hidden directory and "..data" symlink is atomically swapped
+func writeVersion(t *testing.T, dir, version string, files map[string]string) {
+	t.Helper()
+
+	vdir := filepath.Join(dir, "..ver"+version)
+	if err := os.Mkdir(vdir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, val := range files {
+		if err := os.WriteFile(filepath.Join(vdir, name), []byte(val), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); err != nil {
+			if err := os.Symlink(filepath.Join("..data", name), link); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(filepath.Base(vdir), tmp); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeVersion(t, dir, "1", map[string]string{
+		"DB_PASSWORD":       "secret\n",
+		"SERVICE_HTTP_PORT": "8080",
+	})
+
+	cfg := dirConfig{}
+	if err := LoadDir(&cfg, dir); err != nil {
+		t.Fatalf("LoadDir returned error: %s", err)
+	}
+
+	if cfg.Password != "secret" || cfg.Server.Port != 8080 {
+		t.Errorf("Invalid values loaded from directory: %+v", cfg)
+	}
+
+	os.Setenv(CredentialsDirEnv, dir)
+	defer os.Unsetenv(CredentialsDirEnv)
+
+	cfg = dirConfig{}
+	if err := LoadCredentials(&cfg); err != nil {
+		t.Fatalf("LoadCredentials returned error: %s", err)
+	}
+
+	if cfg.Password != "secret" {
+		t.Errorf("Invalid values loaded from credentials: %+v", cfg)
+	}
+}
+
+func TestWatchDir(t *testing.T) {
+	dir := t.TempDir()
+	writeVersion(t, dir, "1", map[string]string{"DB_PASSWORD": "old"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+	go WatchDir(ctx, dir, 10*time.Millisecond, func() {
+		changed <- struct{}{}
+	})
+
+	// Give watcher time to read the initial state
+	time.Sleep(30 * time.Millisecond)
+	writeVersion(t, dir, "2", map[string]string{"DB_PASSWORD": "new"})
+
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Change of the directory was not detected")
+	}
+
+	cfg := dirConfig{}
+	if err := LoadDir(&cfg, dir); err != nil {
+		t.Fatalf("LoadDir returned error: %s", err)
+	}
+
+	if cfg.Password != "new" {
+		t.Errorf("cfg.Password(%q) contain invalid value. Expected: new", cfg.Password)
+	}
+}
+
+func TestWatchDirDefaultInterval(t *testing.T) {
+	dir := t.TempDir()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if err := WatchDir(ctx, dir, interval, func() {}); err != nil {
+			t.Errorf("WatchDir with interval %s returned error: %s", interval, err)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// FieldDoc describes configuration field
+type FieldDoc struct {
+	// Path of the field, for example "Server.Port"
+	Path string
+
+	// Env is the name of the environment variable, empty if the field
+	// cannot be set from the environment
+	Env string
+
+	// Toml is the dotted TOML key
+	Toml string
+
+	Type string
+
+	// Default is the value of the field in the struct passed to Docs
+	Default string
+
+	// Description is taken from "desc" struct tag
+	Description string
+
+	Secret bool
+}
+
+// Docs describes all fields of the configuration struct. Values of the
+// passed struct are used as defaults, secrets are masked.
+func Docs(cfg any) ([]FieldDoc, error) {
+	v := reflect.ValueOf(cfg)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, errors.New("config is nil")
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return nil, errors.New("not a struct")
+	}
+
+	var docs []FieldDoc
+	describeStruct(v, "", "", "", true, &docs)
+	return docs, nil
+}
+
+func describeStruct(st reflect.Value, path, envPrefix, tomlPath string, hasEnv bool, docs *[]FieldDoc) {
+
+	t := st.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tf := t.Field(i)
+		f := st.Field(i)
+
+		if tf.PkgPath != "" {
+			continue
+		}
+
+		envName, envOpts := parseTag(tf.Tag.Get("env"))
+		tomlName, _ := parseTag(tf.Tag.Get("toml"))
+		if tomlName == "" {
+			tomlName = tf.Name
+		}
+
+		ft := tf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+			if f.IsNil() {
+				f = reflect.New(ft).Elem()
+			} else {
+				f = f.Elem()
+			}
+		}
+
+		env := ""
+		if hasEnv && envName != "" {
+			env = envName
+			if envPrefix != "" {
+				env = envPrefix + "_" + envName
+			}
+		}
+
+		if ft.Kind() == reflect.Struct && !reflect.PointerTo(ft).Implements(textUnmarshalerType) {
+			// Prefix is built the same way as by fillStructFromEnv,
+			// pointers to structs without tag are ignored by LoadOverrides
+			sectionEnv := envName
+			if envPrefix != "" {
+				sectionEnv = envPrefix + "_" + envName
+			}
+			sectionHasEnv := hasEnv && (tf.Type.Kind() != reflect.Pointer || envName != "")
+
+			sectionToml := joinPath(tomlPath, tomlName)
+			if tf.Anonymous && tf.Tag.Get("toml") == "" {
+				sectionToml = tomlPath
+			}
+
+			if tomlName == "-" {
+				sectionToml = "-"
+			}
+
+			describeStruct(f, joinPath(path, tf.Name), sectionEnv, sectionToml, sectionHasEnv, docs)
+			continue
+		}
+
+		doc := FieldDoc{
+			Path:        joinPath(path, tf.Name),
+			Env:         env,
+			Type:        ft.String(),
+			Description: tf.Tag.Get("desc"),
+			Secret:      isSecretField(tf),
+		}
+
+		if envOpts.Has("prefix") && env != "" {
+			doc.Env = env + "_*"
+		}
+
+		if tomlName != "-" && tomlPath != "-" {
+			doc.Toml = joinPath(tomlPath, tomlName)
+		}
+
+		switch {
+		case doc.Secret:
+			doc.Default = Mask
+		case !f.IsZero():
+			doc.Default = formatDefault(f)
+		}
+
+		*docs = append(*docs, doc)
+	}
+}
+
+func formatDefault(v reflect.Value) string {
+	return strings.Trim(formatValue(v), `"`)
+}
+
+// WriteDocs writes documentation of the configuration struct as
+// a markdown table. Values of the passed struct are used as defaults.
+// Descriptions are taken from the "desc" struct tag:
+//
+//	Port int `env:"HTTP_PORT" desc:"Port to listen on"`
+func WriteDocs(w io.Writer, cfg any) error {
+	docs, err := Docs(cfg)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"Env", "TOML", "Type", "Default", "Description"}}
+	for _, d := range docs {
+		rows = append(rows, []string{d.Env, d.Toml, d.Type, d.Default, d.Description})
+	}
+
+	for i, row := range rows {
+		for j, cell := range row {
+			row[j] = strings.ReplaceAll(cell, "|", `\|`)
+		}
+
+		if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | ")); err != nil {
+			return err
+		}
+
+		if i == 0 {
+			if _, err := fmt.Fprintln(w, "|---|---|---|---|---|"); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
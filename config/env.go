@@ -2,6 +2,7 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"reflect"
 	"strconv"
@@ -32,6 +33,18 @@ import (
 //		// Fore example in this case "SERVICE_" will be prefixed
 //		// for any var name specified in the ConfigSection structue
 //		Section2 ConfigSection `env:"SERVICE"`
+//
+//		// Map with "prefix" option collects every variable which starts
+//		// with the field's prefix. For example LABELS_team=core and
+//		// LABELS_tier=gold produce {"team": "core", "tier": "gold"}.
+//		//
+//		// Optional "case" option normalises the keys: "lower" or "upper"
+//		Labels map[string]string `env:"LABELS,prefix,case=lower"`
+//
+//		// Old names of the variable can be listed with "alias" and
+//		// "deprecated" options. Deprecated names are reported with
+//		// OnDeprecation and become an error since the specified Version.
+//		Port int `env:"HTTP_PORT,alias=PORT,deprecated=SERVER_PORT@2.0"`
 //	}
 func LoadOverrides(cfg any) error {
 	v := reflect.ValueOf(cfg)
@@ -43,10 +56,10 @@ func LoadOverrides(cfg any) error {
 		return errors.New("cfg is nil")
 	}
 
-	return fillStructFromEnv("", v.Elem())
+	return fillStructFromEnv(EnvSource{}, "", v.Elem())
 }
 
-func fillStructFromEnv(prefix string, st reflect.Value) error {
+func fillStructFromEnv(src Source, prefix string, st reflect.Value) error {
 	if st.Kind() != reflect.Struct {
 		return errors.New("not a struct")
 	}
@@ -56,10 +69,7 @@ func fillStructFromEnv(prefix string, st reflect.Value) error {
 		tf := t.Field(i)
 		f := st.Field(i)
 
-		tag := ""
-		if tf.Tag != "" {
-			tag = tf.Tag.Get("env")
-		}
+		tag, opts := parseTag(tf.Tag.Get("env"))
 
 		kind := tf.Type.Kind()
 
@@ -72,7 +82,23 @@ func fillStructFromEnv(prefix string, st reflect.Value) error {
 			tag = prefix + "_" + tag
 		}
 
-		err := fillValue(f, tag)
+		if opts.Has("prefix") {
+			err := fillMapFromEnv(src, f, tag, opts)
+			if err != nil {
+				return FieldError{FieldName: tf.Name, Message: err.Error()}
+			}
+			continue
+		}
+
+		if alts := alternatives(opts); len(alts) > 0 && kind != reflect.Struct {
+			name, err := resolveEnvName(src, prefix, tag, alts)
+			if err != nil {
+				return FieldError{FieldName: tf.Name, Message: err.Error()}
+			}
+			tag = name
+		}
+
+		err := fillValue(src, f, tag, opts.Get("decoder"))
 		if err != nil {
 			return err
 		}
@@ -80,19 +106,157 @@ func fillStructFromEnv(prefix string, st reflect.Value) error {
 	return nil
 }
 
-func fillValue(f reflect.Value, tag string) error {
+// resolveEnvName returns the name of the variable which should be used
+// for the field: either name itself, or one of its alternative names.
+//
+// Returns an error if alternative names are set to different values.
+func resolveEnvName(src Source, prefix string, name string, alts []altName) (string, error) {
+	used := name
+	val, found := src.Lookup(name)
+
+	for _, alt := range alts {
+		altName := alt.name
+		if prefix != "" {
+			altName = prefix + "_" + altName
+		}
+
+		altVal, ok := src.Lookup(altName)
+		if !ok {
+			continue
+		}
+
+		if found && altVal != val {
+			return "", fmt.Errorf("both %q and %q are set to different values", used, altName)
+		}
+
+		if alt.deprecated {
+			err := deprecated(Deprecation{
+				Source:      "env",
+				Name:        altName,
+				Replacement: name,
+				FatalSince:  alt.fatalSince,
+			})
+			if err != nil {
+				return "", err
+			}
+		}
+
+		if !found {
+			used, val, found = altName, altVal, true
+		}
+	}
+
+	return used, nil
+}
+
+// fillMapFromEnv collects all environment variables which start with
+// prefix followed by underscore into the map. Remainder of the variable
+// name becomes the key, which is normalised according to "case" option.
+func fillMapFromEnv(src Source, f reflect.Value, prefix string, opts tagOptions) error {
+	if f.Kind() != reflect.Map || f.Type().Key().Kind() != reflect.String {
+		return errors.New("prefix option requires a map with string keys")
+	}
+
+	normalise, err := keyNormaliser(opts.Get("case"))
+	if err != nil {
+		return err
+	}
+
+	prefix += "_"
+	for _, name := range src.Names() {
+		if !strings.HasPrefix(name, prefix) || name == prefix {
+			continue
+		}
+
+		val, _ := src.Lookup(name)
+
+		if f.IsNil() {
+			f.Set(reflect.MakeMap(f.Type()))
+		}
+
+		key := reflect.New(f.Type().Key()).Elem()
+		key.SetString(normalise(strings.TrimPrefix(name, prefix)))
+
+		elem := reflect.New(f.Type().Elem()).Elem()
+		ok, err := decode(elem, val, opts.Get("decoder"))
+		if !ok {
+			ok, err = unmarshalText(elem, val)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot decode %q: %w", name, err)
+		}
+		if !ok {
+			// Invalid values are ignored the same way as for other fields
+			_ = setValue(elem, val)
+		}
+
+		f.SetMapIndex(key, elem)
+	}
+
+	return nil
+}
+
+func keyNormaliser(keyCase string) (func(string) string, error) {
+	switch keyCase {
+	case "":
+		return func(s string) string { return s }, nil
+	case "lower":
+		return strings.ToLower, nil
+	case "upper":
+		return strings.ToUpper, nil
+	}
+
+	return nil, fmt.Errorf("unknown key case %q", keyCase)
+}
+
+func fillValue(src Source, f reflect.Value, tag string, decoder string) error {
 
 	// TODO: Implement slice type. I.e. comma-separated list of values
 
+	// Registered decoders take precedence over the built-in conversions
+	fn, err := lookupDecoder(f.Type(), decoder)
+	if err != nil {
+		return fmt.Errorf("%q: %w", tag, err)
+	}
+
+	if fn != nil {
+		val, ok := src.Lookup(tag)
+		if !ok {
+			return nil
+		}
+
+		res, err := fn(val)
+		if err == nil {
+			err = assign(f, res)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot decode %q: %w", tag, err)
+		}
+		return nil
+	}
+
+	if f.Kind() != reflect.Pointer && reflect.PointerTo(f.Type()).Implements(textUnmarshalerType) {
+		val, ok := src.Lookup(tag)
+		if !ok {
+			return nil
+		}
+
+		_, err := unmarshalText(f, val)
+		if err != nil {
+			return fmt.Errorf("cannot decode %q: %w", tag, err)
+		}
+		return nil
+	}
+
 	kind := f.Kind()
 
 	switch kind {
 	case reflect.Pointer:
-		_, ok := os.LookupEnv(tag)
+		_, ok := src.Lookup(tag)
 		if ok {
 			if f.IsNil() {
 				newVal := reflect.New(f.Type().Elem())
-				err := fillValue(newVal.Elem(), tag)
+				err := fillValue(src, newVal.Elem(), tag, decoder)
 				if err != nil {
 					return err
 				}
@@ -101,54 +265,62 @@ func fillValue(f reflect.Value, tag string) error {
 		}
 
 	case reflect.Struct:
-		err := fillStructFromEnv(tag, f)
+		err := fillStructFromEnv(src, tag, f)
 		if err != nil {
 			return err
 		}
 
-	case reflect.Float32, reflect.Float64:
-		val, ok := os.LookupEnv(tag)
+	default:
+		val, ok := src.Lookup(tag)
 		if ok {
-			i, err := strconv.ParseFloat(val, 64)
-			if err == nil {
-				f.SetFloat(i)
-			}
+			// Values which cannot be parsed are ignored
+			_ = setValue(f, val)
 		}
+	}
+
+	return nil
+}
+
+// setValue parses string value into the field of a basic type.
+func setValue(f reflect.Value, val string) error {
+
+	switch f.Kind() {
+	case reflect.Float32, reflect.Float64:
+		i, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(i)
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		val, ok := os.LookupEnv(tag)
-		if ok {
-			i, err := strconv.ParseInt(val, 10, 64)
-			if err == nil {
-				f.SetInt(i)
-			}
+		i, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return err
 		}
+		f.SetInt(i)
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		val, ok := os.LookupEnv(tag)
-		if ok {
-			i, err := strconv.ParseUint(val, 10, 64)
-			if err == nil {
-				f.SetUint(i)
-			}
+		i, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			return err
 		}
+		f.SetUint(i)
 
 	case reflect.Bool:
-		val, ok := os.LookupEnv(tag)
-		if ok {
-			vl := strings.ToLower(val)
-			if vl == "false" || vl == "0" {
-				f.SetBool(false)
-			} else if vl == "true" || vl == "1" {
-				f.SetBool(true)
-			}
+		vl := strings.ToLower(val)
+		if vl == "false" || vl == "0" {
+			f.SetBool(false)
+		} else if vl == "true" || vl == "1" {
+			f.SetBool(true)
+		} else {
+			return fmt.Errorf("invalid boolean value %q", val)
 		}
 
 	case reflect.String:
-		val, ok := os.LookupEnv(tag)
-		if ok {
-			f.SetString(val)
-		}
+		f.SetString(val)
+
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
 	}
 
 	return nil
@@ -102,3 +102,41 @@ func TestLoadSectionFromEnv(t *testing.T) {
 			s.NPref.A, fPrefixedNestedStr)
 	}
 }
+
+func TestLoadPrefixedMapFromEnv(t *testing.T) {
+
+	type Section struct {
+		Headers map[string]string `env:"HEADERS,prefix"`
+	}
+
+	type MyStruct struct {
+		Labels  map[string]string `env:"LABELS,prefix,case=lower"`
+		Weights map[string]int    `env:"WEIGHTS,prefix"`
+		Service Section           `env:"SVC"`
+	}
+
+	os.Setenv("LABELS_Team", "core")
+	os.Setenv("LABELS_TIER", "gold")
+	os.Setenv("WEIGHTS_a", "10")
+	os.Setenv("SVC_HEADERS_X-Request-Source", "api")
+	os.Setenv("HEADERS_Unrelated", "value")
+
+	s := &MyStruct{}
+
+	err := LoadOverrides(s)
+	if err != nil {
+		t.Fatalf("LoadOverrides returned error: %s", err)
+	}
+
+	if len(s.Labels) != 2 || s.Labels["team"] != "core" || s.Labels["tier"] != "gold" {
+		t.Errorf("s.Labels(%v) contain invalid value", s.Labels)
+	}
+
+	if len(s.Weights) != 1 || s.Weights["a"] != 10 {
+		t.Errorf("s.Weights(%v) contain invalid value", s.Weights)
+	}
+
+	if len(s.Service.Headers) != 1 || s.Service.Headers["X-Request-Source"] != "api" {
+		t.Errorf("s.Service.Headers(%v) contain invalid value", s.Service.Headers)
+	}
+}
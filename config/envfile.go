@@ -63,13 +63,32 @@ func EnvFile(fn string) (string, error) {
 // The format of the string is key=value
 func LoadEnvFile(fn string) error {
 	log.Printf("Loading env vars from %q file", fn)
+	src, err := EnvFileSource(fn)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range src {
+		err = os.Setenv(key, value)
+		if err != nil {
+			return fmt.Errorf("cannot set env variable: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// EnvFileSource reads all key=value pairs from fn file without
+// changing the environment of the process
+func EnvFileSource(fn string) (MapSource, error) {
 	f, err := os.Open(fn)
 	if err != nil {
-		return fmt.Errorf("cannot open file: %q: %w", fn, err)
+		return nil, fmt.Errorf("cannot open file: %q: %w", fn, err)
 	}
 
 	defer f.Close()
 
+	src := MapSource{}
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		key, value, err := parseEnvLine(scanner.Text())
@@ -77,13 +96,14 @@ func LoadEnvFile(fn string) error {
 			continue
 		}
 
-		err = os.Setenv(key, value)
-		if err != nil {
-			return fmt.Errorf("cannot set env variable: %w", err)
-		}
+		src[key] = value
 	}
 
-	return nil
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read file: %q: %w", fn, err)
+	}
+
+	return src, nil
 }
 
 // parseEnvLine splits line into the key, value pairs. Line can be in the
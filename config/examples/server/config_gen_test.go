@@ -0,0 +1,72 @@
+// Code generated by configgen -type Config -test; DO NOT EDIT.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/fednep/goapilib/config"
+)
+
+func TestConfigGenerated(t *testing.T) {
+	src := config.MapSource{
+		"SERVER_HTTP_ADDRESS":              "sample-1",
+		"SERVER_HTTP_CERT_FILE":            "sample-4",
+		"SERVER_HTTP_CERT_RELOAD_INTERVAL": "90s",
+		"SERVER_HTTP_CLIENT_AUTH":          "sample-23",
+		"SERVER_HTTP_CLIENT_CA_FILE":       "sample-24",
+		"SERVER_HTTP_DEV_TLS":              "true",
+		"SERVER_HTTP_DEV_TLS_CACHE_DIR":    "sample-21",
+		"SERVER_HTTP_DISABLE_HTTP2":        "true",
+		"SERVER_HTTP_DISABLE_KEEP_ALIVES":  "true",
+		"SERVER_HTTP_IDLE_TIMEOUT":         "90s",
+		"SERVER_HTTP_KEY_FILE":             "sample-5",
+		"SERVER_HTTP_MAX_BODY_SIZE":        "10MiB",
+		"SERVER_HTTP_MAX_HEADER_BYTES":     "10MiB",
+		"SERVER_HTTP_PORT":                 "2",
+		"SERVER_HTTP_PROXY_HEADER_TIMEOUT": "90s",
+		"SERVER_HTTP_PROXY_PROTOCOL":       "true",
+		"SERVER_HTTP_READ_HEADER_TIMEOUT":  "90s",
+		"SERVER_HTTP_READ_TIMEOUT":         "90s",
+		"SERVER_HTTP_SHUTDOWN_TIMEOUT":     "90s",
+		"SERVER_HTTP_SOCKET_GROUP":         "sample-8",
+		"SERVER_HTTP_SOCKET_MODE":          "sample-6",
+		"SERVER_HTTP_SOCKET_OWNER":         "sample-7",
+		"SERVER_HTTP_TIMEOUT":              "90s",
+		"SERVER_HTTP_TLS_MIN_VERSION":      "sample-18",
+		"SERVER_HTTP_USE_TLS":              "true",
+		"SERVER_HTTP_WRITE_TIMEOUT":        "90s",
+	}
+
+	var want, got Config
+	if err := config.LoadFrom(&want, src); err != nil {
+		t.Fatalf("LoadFrom: %s", err)
+	}
+
+	if err := got.LoadFromEnv(src); err != nil {
+		t.Fatalf("LoadFromEnv: %s", err)
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		changes, _ := config.Diff(want, got)
+		t.Fatalf("LoadFromEnv differs from LoadFrom: %v", changes)
+	}
+
+	for _, cfg := range []Config{{}, want} {
+		err, genErr := config.IsValid(cfg), cfg.Validate()
+		if fmt.Sprint(genErr) != fmt.Sprint(err) || config.FieldPath(genErr) != config.FieldPath(err) {
+			t.Errorf("Validate() = %v, IsValid() = %v", genErr, err)
+		}
+
+		docs, err := config.Docs(cfg)
+		if err != nil {
+			t.Fatalf("Docs: %s", err)
+		}
+
+		if genDocs := cfg.Docs(); !reflect.DeepEqual(genDocs, docs) {
+			t.Errorf("Docs() = %+v, want %+v", genDocs, docs)
+		}
+	}
+}
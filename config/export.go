@@ -0,0 +1,302 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ExportOptions specify the format of Export output
+type ExportOptions struct {
+	// Format is one of "toml" (default), "json" or "env"
+	Format string
+
+	// MaskSecrets replaces values of the fields marked as secret with Mask.
+	// Output with masked secrets cannot be loaded back.
+	MaskSecrets bool
+}
+
+// Export writes loaded configuration in TOML, JSON or .env format.
+//
+// TOML and JSON use the same keys as LoadToml and LoadJSON, .env uses the
+// names from "env" tags as LoadOverrides does, so the output can be loaded
+// back into the identical struct. Values of the types implementing
+// encoding.TextMarshaler (like Duration or ByteSize) are written as text.
+func Export(w io.Writer, cfg any, opts ExportOptions) error {
+	v := reflect.ValueOf(cfg)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return errors.New("config is nil")
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return errors.New("not a struct")
+	}
+
+	switch opts.Format {
+	case "", "toml":
+		tree, err := exportTree(v, opts.MaskSecrets)
+		if err != nil {
+			return err
+		}
+		return toml.NewEncoder(w).Encode(tree)
+
+	case "json":
+		tree, err := exportTree(v, opts.MaskSecrets)
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(tree)
+
+	case "env":
+		var lines []string
+		if err := exportEnv("", v, opts.MaskSecrets, &lines); err != nil {
+			return err
+		}
+
+		for _, line := range lines {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown export format %q", opts.Format)
+}
+
+// exportTree converts struct into the tree of maps with the keys
+// used by LoadToml
+func exportTree(st reflect.Value, mask bool) (map[string]any, error) {
+	tree := map[string]any{}
+
+	t := st.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tf := t.Field(i)
+		f := st.Field(i)
+
+		if tf.PkgPath != "" {
+			continue
+		}
+
+		name, _ := parseTag(tf.Tag.Get("toml"))
+		if name == "-" {
+			continue
+		}
+
+		if tf.Anonymous && name == "" && tf.Type.Kind() == reflect.Struct {
+			sub, err := exportTree(f, mask)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range sub {
+				tree[k] = v
+			}
+			continue
+		}
+
+		if name == "" {
+			name = tf.Name
+		}
+
+		if mask && isSecretField(tf) {
+			tree[name] = Mask
+			continue
+		}
+
+		val, ok, err := exportValue(f, mask)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] %w", name, err)
+		}
+
+		if ok {
+			tree[name] = val
+		}
+	}
+
+	return tree, nil
+}
+
+// exportValue converts field into the value which can be encoded into
+// TOML or JSON. Returns false for nil values, which are omitted.
+func exportValue(f reflect.Value, mask bool) (any, bool, error) {
+
+	switch f.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if f.IsNil() {
+			return nil, false, nil
+		}
+		return exportValue(f.Elem(), mask)
+	}
+
+	if t, ok := f.Interface().(time.Time); ok {
+		return t, true, nil
+	}
+
+	if m, ok := f.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return nil, false, err
+		}
+		return string(text), true, nil
+	}
+
+	switch f.Kind() {
+	case reflect.Struct:
+		tree, err := exportTree(f, mask)
+		return tree, err == nil, err
+
+	case reflect.Map:
+		if f.IsNil() {
+			return nil, false, nil
+		}
+
+		res := map[string]any{}
+		iter := f.MapRange()
+		for iter.Next() {
+			val, ok, err := exportValue(iter.Value(), mask)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				res[fmt.Sprint(iter.Key().Interface())] = val
+			}
+		}
+		return res, true, nil
+
+	case reflect.Slice, reflect.Array:
+		if f.Kind() == reflect.Slice && f.IsNil() {
+			return nil, false, nil
+		}
+
+		res := make([]any, 0, f.Len())
+		for i := 0; i < f.Len(); i++ {
+			val, _, err := exportValue(f.Index(i), mask)
+			if err != nil {
+				return nil, false, err
+			}
+			res = append(res, val)
+		}
+		return res, true, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return f.Int(), true, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(f.Uint()), true, nil
+
+	case reflect.Float32, reflect.Float64:
+		return f.Float(), true, nil
+
+	case reflect.Bool:
+		return f.Bool(), true, nil
+
+	case reflect.String:
+		return f.String(), true, nil
+	}
+
+	return nil, false, fmt.Errorf("unsupported type %s", f.Type())
+}
+
+// exportEnv writes key=value lines for the fields with "env" tags,
+// using the same prefixes of the nested sections as fillStructFromEnv
+func exportEnv(prefix string, st reflect.Value, mask bool, lines *[]string) error {
+
+	t := st.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tf := t.Field(i)
+		f := st.Field(i)
+
+		tag, opts := parseTag(tf.Tag.Get("env"))
+
+		kind := tf.Type.Kind()
+		if tag == "" && kind != reflect.Struct {
+			continue
+		}
+
+		if prefix != "" {
+			tag = prefix + "_" + tag
+		}
+
+		if kind == reflect.Pointer {
+			if f.IsNil() {
+				continue
+			}
+			f = f.Elem()
+		}
+
+		secret := mask && isSecretField(tf)
+
+		if opts.Has("prefix") && f.Kind() == reflect.Map {
+			keys := f.MapKeys()
+			sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+			for _, k := range keys {
+				if err := exportEnvLine(tag+"_"+k.String(), f.MapIndex(k), secret, lines); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if f.Kind() == reflect.Struct && !reflect.PointerTo(f.Type()).Implements(textUnmarshalerType) {
+			if err := exportEnv(tag, f, mask, lines); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := exportEnvLine(tag, f, secret, lines); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func exportEnvLine(name string, f reflect.Value, secret bool, lines *[]string) error {
+	val := Mask
+	if !secret {
+		v, ok, err := exportValue(f, false)
+		if err != nil {
+			return fmt.Errorf("%q: %w", name, err)
+		}
+
+		if !ok {
+			return nil
+		}
+
+		// LoadOverrides doesn't support lists, so they are skipped
+		switch v.(type) {
+		case map[string]any, []any:
+			return nil
+		}
+
+		val = fmt.Sprint(v)
+	}
+
+	if strings.ContainsAny(val, "\n\r") {
+		return fmt.Errorf("%q: multiline values cannot be exported as env variable", name)
+	}
+
+	// Quotes preserve leading and trailing spaces (see parseEnvLine)
+	if val != strings.TrimSpace(val) || strings.HasPrefix(val, `"`) {
+		val = `"` + val + `"`
+	}
+
+	*lines = append(*lines, name+"="+val)
+	return nil
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type exportSection struct {
+	Address string   `env:"ADDRESS"`
+	Port    uint16   `env:"PORT" toml:"port"`
+	Timeout Duration `env:"TIMEOUT"`
+}
+
+type exportConfig struct {
+	Name     string            `env:"EXP_NAME"`
+	Password string            `env:"EXP_PASSWORD" secret:"true"`
+	MaxBody  ByteSize          `env:"EXP_MAX_BODY"`
+	Rate     Percent           `env:"EXP_RATE"`
+	Debug    *bool             `env:"EXP_DEBUG"`
+	Labels   map[string]string `env:"EXP_LABELS,prefix"`
+	Server   exportSection     `env:"EXP_SERVER"`
+	Hosts    []string
+}
+
+func newExportConfig() exportConfig {
+	debug := true
+	return exportConfig{
+		Name:     " padded name ",
+		Password: "secret",
+		MaxBody:  10 * MiB,
+		Rate:     0.05,
+		Debug:    &debug,
+		Labels:   map[string]string{"team": "core"},
+		Server:   exportSection{Address: "127.0.0.1", Port: 8080, Timeout: Duration(90 * time.Second)},
+		Hosts:    []string{"a", "b"},
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	cfg := newExportConfig()
+
+	loaders := map[string]func(any, string) error{
+		"toml": LoadToml,
+		"json": LoadJSON,
+		"env": func(cfg any, fn string) error {
+			src, err := EnvFileSource(fn)
+			if err != nil {
+				return err
+			}
+			return LoadFrom(cfg, src)
+		},
+	}
+
+	for format, load := range loaders {
+		buf := bytes.Buffer{}
+		if err := Export(&buf, cfg, ExportOptions{Format: format}); err != nil {
+			t.Fatalf("Export(%s) returned error: %s", format, err)
+		}
+
+		fn := filepath.Join(t.TempDir(), "config."+format)
+		if err := os.WriteFile(fn, buf.Bytes(), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded := exportConfig{}
+		if err := load(&loaded, fn); err != nil {
+			t.Fatalf("Loading %s returned error: %s\n%s", format, err, buf.String())
+		}
+
+		// Lists are not supported in env variables
+		if format == "env" {
+			loaded.Hosts = cfg.Hosts
+		}
+
+		if !reflect.DeepEqual(cfg, loaded) {
+			changes, _ := Diff(cfg, loaded)
+			t.Errorf("Config loaded from %s is different: %v\n%s", format, changes, buf.String())
+		}
+	}
+}
+
+func TestExportMaskSecrets(t *testing.T) {
+	for _, format := range []string{"toml", "json", "env"} {
+		buf := bytes.Buffer{}
+		err := Export(&buf, newExportConfig(), ExportOptions{Format: format, MaskSecrets: true})
+		if err != nil {
+			t.Fatalf("Export(%s) returned error: %s", format, err)
+		}
+
+		if strings.Contains(buf.String(), "secret") || !strings.Contains(buf.String(), Mask) {
+			t.Errorf("Secret is not masked in %s output:\n%s", format, buf.String())
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := newExportConfig()
+	b := newExportConfig()
+
+	b.Password = "new-secret"
+	b.Server.Timeout = Duration(time.Minute)
+	b.Labels = map[string]string{"team": "edge", "tier": "gold"}
+	b.Debug = nil
+
+	if _, err := Diff(a, &b); err == nil {
+		t.Fatalf("Expected error comparing configs of different types")
+	}
+
+	changes, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("Diff returned error: %s", err)
+	}
+
+	expected := []Change{
+		{Path: "Password", Old: Mask, New: Mask},
+		{Path: "Debug", Old: "true", New: "<nil>"},
+		{Path: "Labels[team]", Old: `"core"`, New: `"edge"`},
+		{Path: "Labels[tier]", Old: "<none>", New: `"gold"`},
+		{Path: "Server.Timeout", Old: "1m30s", New: "1m0s"},
+	}
+
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Unexpected changes:\n%v\nExpected:\n%v", changes, expected)
+	}
+}
+
+func TestDiffMapEntries(t *testing.T) {
+	type upstreams struct {
+		Servers map[string]exportSection
+		Nested  map[string]map[string]string
+	}
+
+	a := upstreams{
+		Servers: map[string]exportSection{"api": {Address: "10.0.0.1", Port: 80}},
+		Nested:  map[string]map[string]string{"eu": {"host": "eu1"}},
+	}
+	b := upstreams{
+		Servers: map[string]exportSection{"web": {Address: "10.0.0.2", Port: 8080}},
+		Nested:  map[string]map[string]string{"us": {"host": "us1"}},
+	}
+
+	changes, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("Diff returned error: %s", err)
+	}
+
+	expected := []Change{
+		{Path: "Servers[api]", Old: "{10.0.0.1 80 0s}", New: "<none>"},
+		{Path: "Servers[web]", Old: "<none>", New: "{10.0.0.2 8080 0s}"},
+		{Path: "Nested[eu]", Old: "map[host:eu1]", New: "<none>"},
+		{Path: "Nested[us]", Old: "<none>", New: "map[host:us1]"},
+	}
+
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Unexpected changes:\n%v\nExpected:\n%v", changes, expected)
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Functions in this file are exported only for the code generated with
+// configgen, to share the semantics of the reflective loader for the values
+// which cannot be handled by the generated code itself. They are not meant
+// to be called directly, and may change together with the generator.
+
+// LookupTag is for generated code only. It looks up value of the field
+// with "env" tag the same way as LoadOverrides does, including "alias" and
+// "deprecated" names. Returns the name of the variable which holds the value.
+func LookupTag(src Source, prefix string, tag string) (string, string, bool, error) {
+	name, opts := parseTag(tag)
+	if prefix != "" {
+		name = prefix + "_" + name
+	}
+
+	if alts := alternatives(opts); len(alts) > 0 {
+		var err error
+		name, err = resolveEnvName(src, prefix, name, alts)
+		if err != nil {
+			return "", "", false, err
+		}
+	}
+
+	val, ok := src.Lookup(name)
+	return name, val, ok, nil
+}
+
+// DecodeValue is for generated code only. It sets the value ptr points to
+// from string val the same way as LoadOverrides does: using registered
+// decoders, TextUnmarshaler or parsing basic types. Values of basic types
+// which cannot be parsed are ignored.
+//
+// name is the name of the variable used in error messages.
+func DecodeValue(ptr any, name string, val string, decoder string) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return errors.New("non-nil pointer expected")
+	}
+
+	return fillValue(MapSource{name: val}, v.Elem(), name, decoder)
+}
+
+// DecodeRegistered is for generated code only. It sets the value ptr
+// points to from string val with the decoder registered for type T (see
+// RegisterDecoder), as LoadOverrides does. Returns false if there is no
+// decoder for T.
+//
+// name is the name of the variable used in error messages.
+func DecodeRegistered[T any](ptr *T, name string, val string) (bool, error) {
+	fn, _ := lookupDecoder(reflect.TypeOf(ptr).Elem(), "")
+	if fn == nil {
+		return false, nil
+	}
+
+	res, err := fn(val)
+	if err == nil {
+		err = assign(reflect.ValueOf(ptr).Elem(), res)
+	}
+	if err != nil {
+		return true, fmt.Errorf("cannot decode %q: %w", name, err)
+	}
+
+	return true, nil
+}
+
+// FillPrefixMap is for generated code only. It fills map ptr points to
+// with all values under the prefix, the same way as LoadOverrides does for
+// the fields with "prefix" option. tag holds the options of the field,
+// for example "LABELS,prefix,case=lower".
+func FillPrefixMap(src Source, ptr any, prefix string, tag string) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return errors.New("non-nil pointer expected")
+	}
+
+	_, opts := parseTag(tag)
+	return fillMapFromEnv(src, v.Elem(), prefix, opts)
+}
+
+// DocDefault is for generated code only. It formats value as
+// FieldDoc.Default, zero values are omitted
+func DocDefault(val any) string {
+	v := reflect.ValueOf(val)
+	if !v.IsValid() || v.IsZero() {
+		return ""
+	}
+
+	return formatDefault(v)
+}
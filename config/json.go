@@ -0,0 +1,74 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+
+	"github.com/BurntSushi/toml"
+)
+
+// LoadJSON loads configuration from JSON file into the cfg struct.
+//
+// Keys are matched to the fields the same way as by LoadToml, so files
+// written by Export in "json" format can be loaded back.
+func LoadJSON(cfg any, fn string) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr {
+		return errors.New("cfg is a non-pointer")
+	}
+
+	if v.IsNil() {
+		return errors.New("cfg is nil")
+	}
+
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	tree := map[string]any{}
+	if err := decoder.Decode(&tree); err != nil {
+		return err
+	}
+
+	// Document is converted to TOML, so values are decoded exactly
+	// the same way
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(jsonToToml(tree)); err != nil {
+		return err
+	}
+
+	return decodeToml(buf.String(), v.Elem())
+}
+
+// jsonToToml converts numbers to the types produced by TOML decoder
+func jsonToToml(v any) any {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+
+	case map[string]any:
+		for k, item := range val {
+			val[k] = jsonToToml(item)
+		}
+		return val
+
+	case []any:
+		for i, item := range val {
+			val[i] = jsonToToml(item)
+		}
+		return val
+	}
+
+	return v
+}
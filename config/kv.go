@@ -0,0 +1,355 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KVSource loads values from the remote key/value store with
+// Consul-compatible HTTP API (GET /v1/kv/<prefix>?recurse=true).
+//
+// Keys are mapped to the names used in "env" tags by removing Prefix and
+// replacing "/" with "_", so "service/api/SERVICE/HTTP_PORT" with
+// "service/api/" prefix becomes "SERVICE_HTTP_PORT".
+//
+// Usage pattern:
+//
+//	kv := &config.KVSource{URL: "http://127.0.0.1:8500/v1/kv", Prefix: "service/api/"}
+//	err := kv.Load(ctx)
+//	...
+//	err = config.LoadFrom(&cfg, kv, config.EnvSource{})
+type KVSource struct {
+	// URL of the KV API without trailing "/", for example
+	// "http://127.0.0.1:8500/v1/kv"
+	URL string
+
+	// Prefix of the keys to load. Leading "/" is ignored.
+	Prefix string
+
+	// Token is sent in X-Consul-Token header if specified
+	Token string
+
+	// CacheFile is used to store the last loaded values. When the remote
+	// is unreachable or fails with 5xx status during Load, values from
+	// the cache file are used.
+	CacheFile string
+
+	// Timeout limits duration of the requests, DefaultKVTimeout if not set.
+	// Long-poll requests in Watch are allowed WaitTime in addition.
+	Timeout time.Duration
+
+	// WaitTime is the maximum duration of the long-poll request in Watch.
+	// Default is 5 minutes.
+	WaitTime time.Duration
+
+	// HTTPClient is used for requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+
+	mu        sync.RWMutex
+	values    MapSource
+	index     uint64
+	fromCache bool
+}
+
+// DefaultKVTimeout is used when KVSource.Timeout is not set
+const DefaultKVTimeout = 10 * time.Second
+
+// kvUnavailableError marks errors after which cached values can be used:
+// network errors and 5xx responses. Other errors, like 403, usually mean
+// the configuration is wrong and are returned as is.
+type kvUnavailableError struct {
+	err error
+}
+
+func (e kvUnavailableError) Error() string {
+	return e.err.Error()
+}
+
+func (e kvUnavailableError) Unwrap() error {
+	return e.err
+}
+
+type kvPair struct {
+	Key   string
+	Value []byte
+}
+
+func (s *KVSource) Lookup(name string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.values.Lookup(name)
+}
+
+func (s *KVSource) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.values.Names()
+}
+
+// FromCache reports whether values were loaded from the cache file
+// because the remote was unavailable
+func (s *KVSource) FromCache() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.fromCache
+}
+
+// Load loads all values under the Prefix. If the remote is unreachable
+// or fails with 5xx status and CacheFile exists, values are loaded from
+// the cache.
+func (s *KVSource) Load(ctx context.Context) error {
+	values, index, err := s.fetch(ctx, 0)
+	if err == nil {
+		s.update(values, index)
+		return nil
+	}
+
+	var unavailable kvUnavailableError
+	if s.CacheFile == "" || !errors.As(err, &unavailable) {
+		return err
+	}
+
+	cached, cacheErr := s.readCache()
+	if cacheErr != nil {
+		return fmt.Errorf("%w (cache is not available: %s)", err, cacheErr)
+	}
+
+	log.Printf("KV store is unavailable (%s), using cached values from %q", err, s.CacheFile)
+
+	s.mu.Lock()
+	s.values = cached
+	s.fromCache = true
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Watch waits for the changes of the values using blocking queries and
+// calls onChange after new values are loaded. Errors are retried with
+// increasing delay. Blocks until context is cancelled.
+func (s *KVSource) Watch(ctx context.Context, onChange func()) error {
+	delay := time.Second
+
+	for {
+		s.mu.RLock()
+		index := s.index
+		s.mu.RUnlock()
+
+		values, newIndex, err := s.fetch(ctx, index)
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			log.Printf("Error watching KV store: %s", err)
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(delay):
+			}
+
+			if delay < time.Minute {
+				delay *= 2
+			}
+			continue
+		}
+		delay = time.Second
+
+		// Index can go backwards if the store was restored,
+		// in this case the next request should start from scratch
+		if newIndex < index {
+			newIndex = 0
+		}
+
+		if s.update(values, newIndex) {
+			onChange()
+		}
+
+		// Without index the request doesn't block, so the store is polled
+		if newIndex == 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(delay):
+			}
+		}
+	}
+}
+
+// update stores new values and returns true if they are different
+// from the previous ones
+func (s *KVSource) update(values MapSource, index uint64) bool {
+	s.mu.Lock()
+	changed := s.fromCache || !reflect.DeepEqual(s.values, values)
+	s.values = values
+	s.index = index
+	s.fromCache = false
+	s.mu.Unlock()
+
+	if changed && s.CacheFile != "" {
+		if err := s.writeCache(values); err != nil {
+			log.Printf("Cannot write KV cache file %q: %s", s.CacheFile, err)
+		}
+	}
+
+	return changed
+}
+
+// prefix returns Prefix as keys in the store start with it
+func (s *KVSource) prefix() string {
+	return strings.TrimLeft(s.Prefix, "/")
+}
+
+// fetch loads values under the prefix. If index is not zero, request blocks
+// until the values are changed after that index or WaitTime passes.
+func (s *KVSource) fetch(ctx context.Context, index uint64) (MapSource, uint64, error) {
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = DefaultKVTimeout
+	}
+
+	q := url.Values{}
+	q.Set("recurse", "true")
+	if index > 0 {
+		wait := s.WaitTime
+		if wait == 0 {
+			wait = 5 * time.Minute
+		}
+
+		q.Set("index", strconv.FormatUint(index, 10))
+		q.Set("wait", fmt.Sprintf("%ds", int(wait.Seconds())))
+		timeout += wait
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	furl := fmt.Sprintf("%s/%s?%s", s.URL, s.prefix(), q.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", furl, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot create request: %w", err)
+	}
+
+	if s.Token != "" {
+		req.Header.Set("X-Consul-Token", s.Token)
+	}
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, kvUnavailableError{fmt.Errorf("error requesting %q: %w", s.URL, err)}
+	}
+
+	defer resp.Body.Close()
+
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+
+	// No keys under the prefix
+	if resp.StatusCode == http.StatusNotFound {
+		return MapSource{}, newIndex, nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, kvUnavailableError{fmt.Errorf("cannot read from response: %w", err)}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("KV store error (%d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+		if resp.StatusCode >= 500 {
+			return nil, 0, kvUnavailableError{err}
+		}
+		return nil, 0, err
+	}
+
+	var pairs []kvPair
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return nil, 0, fmt.Errorf("cannot unmarshal response: %w", err)
+	}
+
+	values := MapSource{}
+	for _, p := range pairs {
+		// Prefix without trailing "/" leaves it in the key
+		name := strings.TrimPrefix(strings.TrimPrefix(p.Key, s.prefix()), "/")
+
+		// Folders are returned as keys with trailing "/"
+		if name == "" || strings.HasSuffix(name, "/") {
+			continue
+		}
+
+		values[strings.ReplaceAll(name, "/", "_")] = string(p.Value)
+	}
+
+	return values, newIndex, nil
+}
+
+func (s *KVSource) readCache() (MapSource, error) {
+	data, err := os.ReadFile(s.CacheFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+
+	if values == nil {
+		return nil, errors.New("cache file is empty")
+	}
+
+	res := MapSource{}
+	for name, val := range values {
+		decoded, err := base64.StdEncoding.DecodeString(val)
+		if err != nil {
+			return nil, err
+		}
+		res[name] = string(decoded)
+	}
+
+	return res, nil
+}
+
+// writeCache stores values base64 encoded, as they can contain arbitrary
+// bytes. The file is replaced atomically.
+func (s *KVSource) writeCache(values MapSource) error {
+	encoded := map[string]string{}
+	for name, val := range values {
+		encoded[name] = base64.StdEncoding.EncodeToString([]byte(val))
+	}
+
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.CacheFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.CacheFile)
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// kvServer is a minimal stand-in for Consul KV API supporting
+// recursive and blocking queries
+type kvServer struct {
+	mu      sync.Mutex
+	index   uint64
+	values  map[string]string
+	changed chan struct{}
+}
+
+func newKVServer(values map[string]string) *kvServer {
+	return &kvServer{index: 1, values: values, changed: make(chan struct{})}
+}
+
+func (s *kvServer) set(key, val string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = val
+	s.index++
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *kvServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+
+	s.mu.Lock()
+	if index > 0 && index == s.index {
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+			return
+		}
+
+		s.mu.Lock()
+	}
+	defer s.mu.Unlock()
+
+	pairs := []kvPair{}
+	for k, v := range s.values {
+		if strings.HasPrefix(k, prefix) {
+			pairs = append(pairs, kvPair{Key: k, Value: []byte(v)})
+		}
+	}
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(s.index, 10))
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(pairs)
+}
+
+func TestKVSource(t *testing.T) {
+	kvs := newKVServer(map[string]string{
+		"service/api/DB_PASSWORD":            "secret",
+		"service/api/SERVICE/HTTP_PORT":      "8080",
+		"service/other/DB_PASSWORD":          "other",
+		"service/api/SERVICE/":               "",
+		"service/api/SERVICE/UNUSED_SETTING": "unused",
+	})
+	srv := httptest.NewServer(kvs)
+
+	cacheFile := filepath.Join(t.TempDir(), "kv-cache.json")
+	kv := &KVSource{URL: srv.URL + "/v1/kv", Prefix: "service/api/", CacheFile: cacheFile}
+
+	if err := kv.Load(context.Background()); err != nil {
+		t.Fatalf("Load returned error: %s", err)
+	}
+
+	cfg := dirConfig{}
+	if err := LoadFrom(&cfg, kv); err != nil {
+		t.Fatalf("LoadFrom returned error: %s", err)
+	}
+
+	if cfg.Password != "secret" || cfg.Server.Port != 8080 {
+		t.Errorf("Invalid values loaded from KV store: %+v", cfg)
+	}
+
+	// Watch for the changes
+	ctx, cancel := context.WithCancel(context.Background())
+	changed := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		kv.Watch(ctx, func() { changed <- struct{}{} })
+		close(done)
+	}()
+
+	kvs.set("service/api/DB_PASSWORD", "new-secret")
+
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Change of the value was not detected")
+	}
+
+	if val, _ := kv.Lookup("DB_PASSWORD"); val != "new-secret" {
+		t.Errorf("DB_PASSWORD(%q) contain invalid value. Expected: new-secret", val)
+	}
+
+	cancel()
+	<-done
+	srv.Close()
+
+	// Remote is not available, values are loaded from the cache
+	kv = &KVSource{URL: srv.URL + "/v1/kv", Prefix: "service/api/", CacheFile: cacheFile}
+	if err := kv.Load(context.Background()); err != nil {
+		t.Fatalf("Load returned error: %s", err)
+	}
+
+	if val, _ := kv.Lookup("DB_PASSWORD"); val != "new-secret" || !kv.FromCache() {
+		t.Errorf("DB_PASSWORD(%q) was not loaded from cache", val)
+	}
+
+	kv = &KVSource{URL: srv.URL + "/v1/kv", Prefix: "service/api/"}
+	if err := kv.Load(context.Background()); err == nil {
+		t.Errorf("Expected error when remote is not available without cache")
+	}
+}
+
+func TestKVSourceErrors(t *testing.T) {
+	status := http.StatusForbidden
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == 0 {
+			<-block
+			return
+		}
+		http.Error(w, "denied", status)
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	cacheFile := filepath.Join(t.TempDir(), "kv-cache.json")
+	if err := (&KVSource{CacheFile: cacheFile}).writeCache(MapSource{"DB_PASSWORD": "cached"}); err != nil {
+		t.Fatal(err)
+	}
+
+	kv := &KVSource{URL: srv.URL + "/v1/kv", Prefix: "service/api/", CacheFile: cacheFile, Timeout: 50 * time.Millisecond}
+
+	// Configuration errors are not hidden by the cache
+	if err := kv.Load(context.Background()); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected 403 error, got %v", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := kv.Load(context.Background()); err != nil || !kv.FromCache() {
+		t.Errorf("Expected values from cache on 503, got %v", err)
+	}
+
+	// Request without deadline of the context times out
+	status = 0
+	kv = &KVSource{URL: srv.URL + "/v1/kv", Prefix: "service/api/", Timeout: 50 * time.Millisecond}
+	if err := kv.Load(context.Background()); err == nil {
+		t.Errorf("Expected timeout error")
+	}
+}
+
+func TestKVSourcePrefix(t *testing.T) {
+	srv := httptest.NewServer(newKVServer(map[string]string{
+		"service/api/DB_PASSWORD":       "secret",
+		"service/api/SERVICE/HTTP_PORT": "8080",
+	}))
+	defer srv.Close()
+
+	for _, prefix := range []string{"/service/api/", "service/api"} {
+		kv := &KVSource{URL: srv.URL + "/v1/kv", Prefix: prefix}
+		if err := kv.Load(context.Background()); err != nil {
+			t.Fatalf("Load returned error: %s", err)
+		}
+
+		cfg := dirConfig{}
+		if err := LoadFrom(&cfg, kv); err != nil {
+			t.Fatalf("LoadFrom returned error: %s", err)
+		}
+
+		if cfg.Password != "secret" || cfg.Server.Port != 8080 {
+			t.Errorf("Invalid values loaded with prefix %q: %+v", prefix, cfg)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Options specify where Load takes the configuration from
+type Options struct {
+	// TomlFile is loaded first if specified
+	TomlFile string
+
+	// EnvFile is read, if specified and exists, and applied right before
+	// EnvSource, so environment variables override values from the file
+	// (see EnvFileSource). If Sources don't include EnvSource, it is
+	// applied last. Environment of the process is not changed.
+	EnvFile string
+
+	// Sources override values from TomlFile in order.
+	// If nil, environment variables are used (EnvSource).
+	Sources []Source
+
+	// Context is used to resolve secrets, context.Background() if nil
+	Context context.Context
+}
+
+// Load loads configuration of type T, which should be a struct:
+//
+//  1. TomlFile is loaded (see LoadToml)
+//  2. Sources and EnvFile override the values (see LoadFrom)
+//  3. References to secrets are resolved (see ResolveSecrets)
+//  4. Configuration is validated (see IsValid)
+//
+// On error zero value of T is returned, never a partially loaded one.
+func Load[T any](opts Options) (T, error) {
+	cfg, err := load[T](opts)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return cfg, nil
+}
+
+func load[T any](opts Options) (T, error) {
+	var cfg T
+
+	if reflect.TypeOf(cfg) == nil || reflect.TypeOf(cfg).Kind() != reflect.Struct {
+		return cfg, fmt.Errorf("config type %T is not a struct", cfg)
+	}
+
+	if opts.TomlFile != "" {
+		if err := LoadToml(&cfg, opts.TomlFile); err != nil {
+			return cfg, fmt.Errorf("cannot load %q: %w", opts.TomlFile, err)
+		}
+	}
+
+	sources := opts.Sources
+	if sources == nil {
+		sources = []Source{EnvSource{}}
+	}
+
+	if opts.EnvFile != "" {
+		exists, err := fileExists(opts.EnvFile)
+		if err != nil {
+			return cfg, err
+		}
+
+		if exists {
+			fileSrc, err := EnvFileSource(opts.EnvFile)
+			if err != nil {
+				return cfg, err
+			}
+			sources = withEnvFile(sources, fileSrc)
+		}
+	}
+
+	if err := LoadFrom(&cfg, sources...); err != nil {
+		return cfg, err
+	}
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := ResolveSecrets(ctx, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if err := IsValid(&cfg); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// withEnvFile returns sources with fileSrc inserted before EnvSource,
+// or appended if there is no EnvSource
+func withEnvFile(sources []Source, fileSrc Source) []Source {
+	res := make([]Source, 0, len(sources)+1)
+	for i, src := range sources {
+		if _, ok := src.(EnvSource); ok {
+			res = append(res, fileSrc)
+			return append(res, sources[i:]...)
+		}
+		res = append(res, src)
+	}
+
+	return append(res, fileSrc)
+}
+
+// MustLoad loads configuration the same way as Load and panics on error.
+// Without options configuration is loaded from environment variables only.
+//
+// Usage pattern:
+//
+//	func main() {
+//		cfg := config.MustLoad[Config](config.Options{TomlFile: "config.toml"})
+//		...
+//	}
+func MustLoad[T any](opts ...Options) T {
+	var o Options
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	cfg, err := Load[T](o)
+	if err != nil {
+		panic(fmt.Sprintf("config: %s", err))
+	}
+
+	return cfg
+}
+
+// Provider holds the current configuration for concurrent readers and
+// allows to reload it, for example when a watched source is changed:
+//
+//	p, err := config.NewProvider[Config](opts)
+//	...
+//	go kv.Watch(ctx, func() { p.Reload() })
+//	...
+//	cfg := p.Get()
+type Provider[T any] struct {
+	opts Options
+
+	// reloadMu serializes reloads, so older configuration can't replace
+	// the newer one
+	reloadMu sync.Mutex
+
+	mu        sync.RWMutex
+	cur       T
+	listeners []func(T)
+}
+
+// NewProvider loads the configuration with Load and returns
+// a provider holding it
+func NewProvider[T any](opts Options) (*Provider[T], error) {
+	cfg, err := Load[T](opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider[T]{opts: opts, cur: cfg}, nil
+}
+
+// Get returns current configuration. Slices and maps in the returned
+// value are shared between readers and must not be modified.
+func (p *Provider[T]) Get() T {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.cur
+}
+
+// OnChange registers a function which is called with the new
+// configuration after it is successfully reloaded
+func (p *Provider[T]) OnChange(fn func(T)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.listeners = append(p.listeners, fn)
+}
+
+// Reload loads configuration again with the same options. If the new
+// configuration cannot be loaded or is not valid, the current one is kept
+// and the error is returned.
+//
+// Concurrent reloads are serialized; the last one to finish wins.
+// OnChange functions are called before Reload returns and must not call
+// Reload.
+func (p *Provider[T]) Reload() error {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	cfg, err := Load[T](p.opts)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.cur = cfg
+	listeners := append([]func(T){}, p.listeners...)
+	p.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(cfg)
+	}
+
+	return nil
+}
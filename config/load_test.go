@@ -0,0 +1,224 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type loadSection struct {
+	Port int `env:"LOAD_PORT"`
+}
+
+func (s loadSection) IsValid() error {
+	if s.Port == 0 {
+		return FieldError{FieldName: "Port", Message: "not configured"}
+	}
+	return nil
+}
+
+type loadConfig struct {
+	Name   string `env:"LOAD_NAME"`
+	Server loadSection
+}
+
+func TestLoad(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(fn, []byte("name = \"service\"\n[server]\nport = 8080\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	src := MapSource{"LOAD_NAME": "${env:LOAD_TEST_NAME}"}
+	os.Setenv("LOAD_TEST_NAME", "from-env")
+	defer os.Unsetenv("LOAD_TEST_NAME")
+
+	cfg, err := Load[loadConfig](Options{TomlFile: fn, Sources: []Source{src}})
+	if err != nil {
+		t.Fatalf("Load returned error: %s", err)
+	}
+
+	if cfg.Name != "from-env" || cfg.Server.Port != 8080 {
+		t.Errorf("Invalid values loaded: %+v", cfg)
+	}
+
+	_, err = Load[loadConfig](Options{Sources: []Source{MapSource{}}})
+
+	var fieldErr FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.FieldName != "Port" {
+		t.Errorf("Expected validation error for Port, got: %v", err)
+	}
+
+	// Partially loaded configuration is not returned
+	cfg, err = Load[loadConfig](Options{Sources: []Source{MapSource{"LOAD_NAME": "partial"}}})
+	if err == nil || cfg != (loadConfig{}) {
+		t.Errorf("Expected zero config with error, got %+v, %v", cfg, err)
+	}
+
+	if _, err := Load[int](Options{}); err == nil {
+		t.Errorf("Expected error for non-struct config type")
+	}
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(fn, []byte("LOAD_NAME=file\nLOAD_PORT=8080\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("LOAD_PORT", "9090")
+
+	p, err := NewProvider[loadConfig](Options{EnvFile: fn})
+	if err != nil {
+		t.Fatalf("NewProvider returned error: %s", err)
+	}
+
+	// Environment variables override the file
+	if cfg := p.Get(); cfg.Name != "file" || cfg.Server.Port != 9090 {
+		t.Errorf("Invalid values loaded: %+v", cfg)
+	}
+
+	if _, ok := os.LookupEnv("LOAD_NAME"); ok {
+		t.Errorf("Environment of the process is changed")
+	}
+
+	// Values removed from the file are removed on reload
+	if err := os.WriteFile(fn, []byte("LOAD_PORT=8080\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Reload(); err != nil {
+		t.Fatalf("Reload returned error: %s", err)
+	}
+
+	if cfg := p.Get(); cfg.Name != "" {
+		t.Errorf("Value removed from the file is kept: %+v", cfg)
+	}
+
+	sources := withEnvFile([]Source{MapSource{}, EnvSource{}}, MapSource{"a": "b"})
+	if len(sources) != 3 || !reflect.DeepEqual(sources[1], MapSource{"a": "b"}) {
+		t.Errorf("Env file is not placed before EnvSource: %v", sources)
+	}
+}
+
+func TestProvider(t *testing.T) {
+	src := MapSource{"LOAD_NAME": "first", "LOAD_PORT": "8080"}
+
+	p, err := NewProvider[loadConfig](Options{Sources: []Source{src}})
+	if err != nil {
+		t.Fatalf("NewProvider returned error: %s", err)
+	}
+
+	var changed loadConfig
+	p.OnChange(func(cfg loadConfig) {
+		changed = cfg
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if name := p.Get().Name; name != "first" && name != "second" {
+				t.Errorf("Unexpected name %q", name)
+			}
+		}()
+	}
+
+	src["LOAD_NAME"] = "second"
+	if err := p.Reload(); err != nil {
+		t.Fatalf("Reload returned error: %s", err)
+	}
+	wg.Wait()
+
+	if p.Get().Name != "second" || changed.Name != "second" {
+		t.Errorf("Configuration was not reloaded: %+v", p.Get())
+	}
+
+	// Invalid configuration is not applied
+	src["LOAD_PORT"] = "0"
+	if err := p.Reload(); err == nil {
+		t.Fatalf("Expected validation error on reload")
+	}
+
+	if p.Get().Server.Port != 8080 {
+		t.Errorf("Invalid configuration was applied: %+v", p.Get())
+	}
+}
+
+// reloadSource blocks the first lookup of the "old" name until released
+type reloadSource struct {
+	mu      sync.Mutex
+	name    string
+	once    sync.Once
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (s *reloadSource) set(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.name = name
+}
+
+func (s *reloadSource) Lookup(name string) (string, bool) {
+	s.mu.Lock()
+	val := s.name
+	s.mu.Unlock()
+
+	switch name {
+	case "LOAD_NAME":
+		if val == "old" {
+			s.once.Do(func() {
+				close(s.blocked)
+				<-s.release
+			})
+		}
+		return val, true
+	case "LOAD_PORT":
+		return "8080", true
+	}
+
+	return "", false
+}
+
+func (s *reloadSource) Names() []string {
+	return []string{"LOAD_NAME", "LOAD_PORT"}
+}
+
+func TestProviderConcurrentReload(t *testing.T) {
+	src := &reloadSource{name: "first", blocked: make(chan struct{}), release: make(chan struct{})}
+
+	p, err := NewProvider[loadConfig](Options{Sources: []Source{src}})
+	if err != nil {
+		t.Fatalf("NewProvider returned error: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	reload := func() {
+		defer wg.Done()
+		if err := p.Reload(); err != nil {
+			t.Errorf("Reload returned error: %s", err)
+		}
+	}
+
+	// The first reload reads the old value and is slow to complete
+	src.set("old")
+	wg.Add(1)
+	go reload()
+	<-src.blocked
+
+	src.set("new")
+	wg.Add(1)
+	go reload()
+
+	close(src.release)
+	wg.Wait()
+
+	if name := p.Get().Name; name != "new" {
+		t.Errorf("Older configuration replaced the newer one: %q", name)
+	}
+}
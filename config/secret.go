@@ -0,0 +1,386 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver resolves references to secrets stored outside of configuration,
+// for example in a file, environment variable or a secret store.
+type Resolver interface {
+	Resolve(ctx context.Context, path string) (string, error)
+}
+
+// ResolverFunc allows to use ordinary functions as a Resolver
+type ResolverFunc func(ctx context.Context, path string) (string, error)
+
+func (f ResolverFunc) Resolve(ctx context.Context, path string) (string, error) {
+	return f(ctx, path)
+}
+
+var resolvers = struct {
+	sync.RWMutex
+	byName map[string]Resolver
+}{
+	byName: map[string]Resolver{
+		"file": ResolverFunc(resolveFile),
+		"env":  ResolverFunc(resolveEnv),
+	},
+}
+
+// RegisterResolver registers resolver for the provider name used in
+// secret references. "file" and "env" resolvers are registered by default.
+func RegisterResolver(provider string, r Resolver) {
+	resolvers.Lock()
+	defer resolvers.Unlock()
+
+	resolvers.byName[provider] = r
+}
+
+// UnregisterResolver removes resolver of the provider, including the
+// default ones
+func UnregisterResolver(provider string) {
+	resolvers.Lock()
+	defer resolvers.Unlock()
+
+	delete(resolvers.byName, provider)
+}
+
+func lookupResolver(provider string) (Resolver, error) {
+	resolvers.RLock()
+	defer resolvers.RUnlock()
+
+	r, ok := resolvers.byName[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown secret provider %q", provider)
+	}
+
+	return r, nil
+}
+
+// resolveFile reads secret from the file. Trailing newline is removed.
+func resolveFile(_ context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveEnv reads secret from the environment variable
+func resolveEnv(_ context.Context, name string) (string, error) {
+	val, ok := os.LookupEnv(strings.TrimPrefix(name, "/"))
+	if !ok {
+		return "", fmt.Errorf("environment variable %q is not set", name)
+	}
+
+	return val, nil
+}
+
+// SecretCacheTTL specifies how long resolved secrets are cached.
+// Zero disables caching.
+var SecretCacheTTL = 5 * time.Minute
+
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+var secretCache = struct {
+	sync.Mutex
+	values map[string]cachedSecret
+}{
+	values: map[string]cachedSecret{},
+}
+
+// ClearSecretCache removes all cached secrets,
+// so they are resolved again on the next ResolveSecrets call
+func ClearSecretCache() {
+	secretCache.Lock()
+	defer secretCache.Unlock()
+
+	secretCache.values = map[string]cachedSecret{}
+}
+
+func resolveCached(ctx context.Context, provider, path string) (string, error) {
+	key := provider + ":" + path
+
+	secretCache.Lock()
+	cached, ok := secretCache.values[key]
+	secretCache.Unlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	r, err := lookupResolver(provider)
+	if err != nil {
+		return "", err
+	}
+
+	val, err := r.Resolve(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve secret %s:%s: %w", provider, path, err)
+	}
+
+	if SecretCacheTTL > 0 {
+		secretCache.Lock()
+		secretCache.values[key] = cachedSecret{value: val, expires: time.Now().Add(SecretCacheTTL)}
+		secretCache.Unlock()
+	}
+
+	return val, nil
+}
+
+const secretScheme = "secret://"
+
+// ${provider:path} references, which can be a part of a bigger string.
+// $${provider:path} is an escaped reference.
+var secretRefRe = regexp.MustCompile(`\$?\$\{(\w+):([^}]*)\}`)
+
+// IsSecretRef reports whether value contains a reference to a secret
+// (or an escaped reference) or is encrypted
+func IsSecretRef(val string) bool {
+	return strings.HasPrefix(val, secretScheme) || IsEncrypted(val) || secretRefRe.MatchString(val)
+}
+
+// resolveValue replaces references to secrets in val with their values.
+//
+// Value can be a reference in the form secret://<provider>/<path>, where
+// path is passed to the resolver with the leading "/", or contain one or more
+// references in the form ${provider:path}. $${provider:path} is replaced
+// with literal ${provider:path}. Encrypted values (see Encrypt) are
+// decrypted with the keys returned by LoadKeys, names are the keys the
+// value could be stored under.
+func resolveValue(ctx context.Context, val string, names []string) (string, error) {
+	if IsEncrypted(val) {
+		return decryptValue(val, names)
+	}
+
+	if strings.HasPrefix(val, secretScheme) {
+		ref := strings.TrimPrefix(val, secretScheme)
+		i := strings.Index(ref, "/")
+		if i <= 0 {
+			return "", fmt.Errorf("invalid secret reference %q", val)
+		}
+
+		return resolveCached(ctx, ref[:i], ref[i:])
+	}
+
+	var resErr error
+	res := secretRefRe.ReplaceAllStringFunc(val, func(ref string) string {
+		if resErr != nil {
+			return ref
+		}
+
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+
+		sm := secretRefRe.FindStringSubmatch(ref)
+
+		secret, err := resolveCached(ctx, sm[1], sm[2])
+		if err != nil {
+			resErr = err
+			return ref
+		}
+
+		return secret
+	})
+
+	if resErr != nil {
+		return "", resErr
+	}
+
+	return res, nil
+}
+
+// ResolveSecrets replaces references to secrets in all string fields of the
+// cfg struct (including nested structs, slices and maps) with their values:
+//
+//	Password string // "secret://vault/db/password" or "${file:/run/secrets/db}"
+//
+// Strings which should contain "${name:...}" literally are escaped
+// as "$${name:...}".
+//
+// Encrypted values ("enc:v1:...") are decrypted as well. They should be
+// encrypted for the TOML key or the name of the variable (see "env" tag)
+// of the field.
+//
+// Secrets are resolved with resolvers registered with RegisterResolver.
+// Errors are reported as FieldError with the path of the field.
+func ResolveSecrets(ctx context.Context, cfg any) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr {
+		return errors.New("cfg is a non-pointer")
+	}
+
+	if v.IsNil() {
+		return errors.New("cfg is nil")
+	}
+
+	return resolveSecrets(ctx, secretNames{}, v.Elem())
+}
+
+// secretNames are the path of the value used in errors, and the keys
+// the value could be loaded from, which encrypted values are bound to
+type secretNames struct {
+	path string
+
+	// toml is a dotted TOML key, noToml is set if the value can't be
+	// loaded from TOML
+	toml   string
+	noToml bool
+
+	// env are names of the variables for fields with "env" tag, and
+	// envPrefix is the prefix of nested fields (see LoadOverrides)
+	env       []string
+	envPrefix string
+}
+
+// keys returns the keys the value could be loaded from
+func (n secretNames) keys() []string {
+	var keys []string
+	if !n.noToml && n.toml != "" {
+		keys = append(keys, n.toml)
+	}
+	return append(keys, n.env...)
+}
+
+// field returns names of the struct field. Names are derived
+// the same way as in LoadToml and LoadFrom.
+func (n secretNames) field(tf reflect.StructField) secretNames {
+	res := secretNames{path: joinPath(n.path, tf.Name), noToml: n.noToml}
+
+	name, _ := parseTag(tf.Tag.Get("toml"))
+	switch {
+	case name == "-":
+		res.noToml = true
+	case tf.Anonymous && name == "" && tf.Type.Kind() == reflect.Struct:
+		res.toml = n.toml
+	case name == "":
+		res.toml = joinPath(n.toml, tf.Name)
+	default:
+		res.toml = joinPath(n.toml, name)
+	}
+
+	tag, opts := parseTag(tf.Tag.Get("env"))
+	if tag == "" && tf.Type.Kind() != reflect.Struct {
+		return res
+	}
+
+	if n.envPrefix != "" {
+		tag = n.envPrefix + "_" + tag
+	}
+
+	if tf.Type.Kind() == reflect.Struct || opts.Has("prefix") {
+		res.envPrefix = tag
+		return res
+	}
+
+	res.env = []string{tag}
+	for _, alt := range alternatives(opts) {
+		if n.envPrefix != "" {
+			res.env = append(res.env, n.envPrefix+"_"+alt.name)
+		} else {
+			res.env = append(res.env, alt.name)
+		}
+	}
+
+	return res
+}
+
+// elem returns names of the map element or slice item
+func (n secretNames) elem(path string, key string) secretNames {
+	res := n
+	res.path = path
+
+	if key != "" {
+		res.toml = joinPath(n.toml, key)
+		res.env = nil
+		if n.envPrefix != "" {
+			res.env = []string{n.envPrefix + "_" + key}
+		}
+	}
+
+	return res
+}
+
+func resolveSecrets(ctx context.Context, names secretNames, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+
+		if v.Kind() == reflect.Interface {
+			// Values stored in interfaces are not addressable
+			elem := reflect.New(v.Elem().Type()).Elem()
+			elem.Set(v.Elem())
+			if err := resolveSecrets(ctx, names, elem); err != nil {
+				return err
+			}
+			v.Set(elem)
+			return nil
+		}
+
+		return resolveSecrets(ctx, names, v.Elem())
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			tf := t.Field(i)
+			if tf.PkgPath != "" {
+				continue
+			}
+
+			err := resolveSecrets(ctx, names.field(tf), v.Field(i))
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			err := resolveSecrets(ctx, names.elem(fmt.Sprintf("%s[%d]", names.path, i), ""), v.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+
+			key := fmt.Sprint(iter.Key())
+			err := resolveSecrets(ctx, names.elem(fmt.Sprintf("%s[%s]", names.path, key), key), elem)
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+
+	case reflect.String:
+		if !v.CanSet() || !IsSecretRef(v.String()) {
+			return nil
+		}
+
+		val, err := resolveValue(ctx, v.String(), names.keys())
+		if err != nil {
+			return FieldError{FieldName: names.path, Message: err.Error()}
+		}
+		v.SetString(val)
+	}
+
+	return nil
+}
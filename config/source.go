@@ -0,0 +1,79 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Source provides configuration values by the names used in "env" tags.
+//
+// Environment variables, directories of files (see DirSource) and remote
+// key/value stores (see KVSource) are all sources, which can be combined
+// with LoadFrom.
+type Source interface {
+	Lookup(name string) (string, bool)
+
+	// Names returns names of all available values
+	Names() []string
+}
+
+// EnvSource looks up values in the environment variables
+type EnvSource struct{}
+
+func (EnvSource) Lookup(name string) (string, bool) {
+	return os.LookupEnv(name)
+}
+
+func (EnvSource) Names() []string {
+	var names []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		names = append(names, name)
+	}
+	return names
+}
+
+// MapSource holds values in memory
+type MapSource map[string]string
+
+func (s MapSource) Lookup(name string) (string, bool) {
+	val, ok := s[name]
+	return val, ok
+}
+
+func (s MapSource) Names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	return names
+}
+
+// LoadFrom loads data into struct from the sources, the same way as
+// LoadOverrides does with environment variables. Sources are applied in
+// order, so values from the later sources override the earlier ones:
+//
+//	err := config.LoadToml(&cfg, "config.toml")
+//	...
+//	err = config.LoadFrom(&cfg, kv, config.EnvSource{})
+func LoadFrom(cfg any, sources ...Source) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr {
+		return errors.New("cfg is a non-pointer")
+	}
+
+	if v.IsNil() {
+		return errors.New("cfg is nil")
+	}
+
+	for _, src := range sources {
+		err := fillStructFromEnv(src, "", v.Elem())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
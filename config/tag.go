@@ -0,0 +1,42 @@
+package config
+
+import "strings"
+
+// tagOptions holds options which follow the name in a struct tag.
+//
+// Options are separated by commas and can be either flags or key=value pairs:
+//
+//	`env:"LABELS,prefix,case=lower"`
+type tagOptions map[string]string
+
+// parseTag splits struct tag into the name and options
+func parseTag(tag string) (string, tagOptions) {
+	name, rest, found := strings.Cut(tag, ",")
+	if !found {
+		return name, nil
+	}
+
+	opts := tagOptions{}
+	for _, opt := range strings.Split(rest, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+
+		key, value, _ := strings.Cut(opt, "=")
+		opts[key] = value
+	}
+
+	return name, opts
+}
+
+// Has reports whether option is present in the tag
+func (o tagOptions) Has(name string) bool {
+	_, ok := o[name]
+	return ok
+}
+
+// Get returns value of the key=value option or empty string
+func (o tagOptions) Get(name string) string {
+	return o[name]
+}
@@ -1,14 +1,366 @@
 package config
 
 import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/BurntSushi/toml"
 )
 
+// LoadToml loads configuration from TOML file into the cfg struct.
+//
+// Values are decoded by github.com/BurntSushi/toml: keys are matched to
+// the fields using "toml" struct tag, or the field name (case insensitive)
+// if there is no tag. Values of the types with registered decoders (see
+// RegisterDecoder) are converted by decoders, as well as the fields with
+// "decoder" tag option:
+//
+//	Ports []int `toml:"ports,decoder=csvints"`
+//
+// Decoders receive strings, numbers and booleans as strings, tables and
+// arrays are decoded into such fields as usual.
+//
+// Old names of the keys can be listed with "alias" and "deprecated" tag
+// options, the same way as for LoadOverrides:
+//
+//	Port int `toml:"port,alias=listen_port,deprecated=http_port@2.0"`
 func LoadToml(cfg any, fn string) error {
-	_, err := toml.DecodeFile(fn, cfg)
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr {
+		return errors.New("cfg is a non-pointer")
+	}
+
+	if v.IsNil() {
+		return errors.New("cfg is nil")
+	}
+
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+
+	return decodeToml(string(data), v.Elem())
+}
+
+// decodeToml decodes TOML document into the addressable value v. Only
+// the fields which need registered decoders or alternative key names
+// are decoded separately, everything else is decoded by toml package.
+func decodeToml(data string, v reflect.Value) error {
+	if !needsTomlDecoder(v.Type()) {
+		_, err := toml.Decode(data, v.Addr().Interface())
+		return err
+	}
+
+	var tbl map[string]toml.Primitive
+	md, err := toml.Decode(data, &tbl)
 	if err != nil {
 		return err
 	}
 
+	return tomlDecoder{md: md}.fillStruct("", tbl, v)
+}
+
+var tomlUnmarshalerType = reflect.TypeOf((*toml.Unmarshaler)(nil)).Elem()
+
+// needsTomlDecoder reports whether values of type t, or any of the values
+// it consists of, need registered decoders or have alternative key names
+func needsTomlDecoder(t reflect.Type) bool {
+	return needsTomlDecoderVisit(t, map[reflect.Type]bool{})
+}
+
+func needsTomlDecoderVisit(t reflect.Type, visited map[reflect.Type]bool) bool {
+	if visited[t] {
+		return false
+	}
+	visited[t] = true
+
+	if fn, _ := lookupDecoder(t, ""); fn != nil {
+		return true
+	}
+
+	// Values which decode themselves are left to them
+	pt := reflect.PointerTo(t)
+	if pt.Implements(tomlUnmarshalerType) || pt.Implements(textUnmarshalerType) {
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return needsTomlDecoderVisit(t.Elem(), visited)
+
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && needsTomlDecoderVisit(t.Elem(), visited)
+
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			tf := t.Field(i)
+			if tf.PkgPath != "" && !tf.Anonymous {
+				continue
+			}
+
+			name, opts := parseTag(tf.Tag.Get("toml"))
+			if name == "-" {
+				continue
+			}
+
+			if opts.Has("decoder") || len(alternatives(opts)) > 0 {
+				return true
+			}
+
+			if needsTomlDecoderVisit(tf.Type, visited) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// tomlDecoder decodes the values which need registered decoders or
+// alternative key names, and passes the rest to toml package
+type tomlDecoder struct {
+	md toml.MetaData
+}
+
+// fillStruct fills st struct with the values from TOML table.
+// path is a dotted path of the table used in messages.
+func (d tomlDecoder) fillStruct(path string, tbl map[string]toml.Primitive, st reflect.Value) error {
+	t := st.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tf := t.Field(i)
+		f := st.Field(i)
+
+		// Unexported fields can't be set
+		if tf.PkgPath != "" && !tf.Anonymous {
+			continue
+		}
+
+		name, opts := parseTag(tf.Tag.Get("toml"))
+		if name == "-" {
+			continue
+		}
+
+		// Embedded structs without tag share the table with the parent
+		if tf.Anonymous && name == "" && tf.Type.Kind() == reflect.Struct {
+			if err := d.fillStruct(path, tbl, f); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if tf.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = tf.Name
+		}
+
+		key, prim, ok := lookupTomlKey(tbl, name)
+
+		if alts := alternatives(opts); len(alts) > 0 {
+			var err error
+			key, prim, ok, err = d.resolveKey(path, tbl, key, prim, ok, name, alts)
+			if err != nil {
+				return FieldError{FieldName: tf.Name, Message: err.Error()}
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := d.decode(joinPath(path, key), f, prim, opts.Get("decoder")); err != nil {
+			return fmt.Errorf("[%s] %w", key, err)
+		}
+	}
+
 	return nil
 }
+
+// resolveKey checks alternative names of the key and returns the one
+// which should be used for the field. Returns an error if alternative names
+// are set to different values.
+func (d tomlDecoder) resolveKey(
+	path string, tbl map[string]toml.Primitive,
+	key string, prim toml.Primitive, found bool,
+	name string, alts []altName) (string, toml.Primitive, bool, error) {
+
+	for _, alt := range alts {
+		altKey, altPrim, ok := lookupTomlKey(tbl, alt.name)
+		if !ok {
+			continue
+		}
+
+		if found && !reflect.DeepEqual(d.raw(prim), d.raw(altPrim)) {
+			return "", prim, false, fmt.Errorf(
+				"both %q and %q are set to different values",
+				joinPath(path, key), joinPath(path, altKey))
+		}
+
+		if alt.deprecated {
+			err := deprecated(Deprecation{
+				Source:      "toml",
+				Name:        joinPath(path, altKey),
+				Replacement: joinPath(path, name),
+				FatalSince:  alt.fatalSince,
+			})
+			if err != nil {
+				return "", prim, false, err
+			}
+		}
+
+		if !found {
+			key, prim, found = altKey, altPrim, true
+		}
+	}
+
+	return key, prim, found, nil
+}
+
+// raw returns the value as it is decoded from TOML: string, int64,
+// float64, bool, time value, map[string]any or []any
+func (d tomlDecoder) raw(prim toml.Primitive) any {
+	var raw any
+	if err := d.md.PrimitiveDecode(prim, &raw); err != nil {
+		return nil
+	}
+	return raw
+}
+
+// decode sets f to the TOML value of the key at path, decoder is the name
+// of the decoder from the tag options
+func (d tomlDecoder) decode(path string, f reflect.Value, prim toml.Primitive, decoder string) error {
+	fn, err := lookupDecoder(f.Type(), decoder)
+	if err != nil {
+		return err
+	}
+
+	if fn != nil {
+		if s, ok := tomlScalar(d.raw(prim)); ok {
+			res, err := fn(s)
+			if err != nil {
+				return err
+			}
+
+			return assign(f, res)
+		}
+	}
+
+	if fn != nil || !needsTomlDecoder(f.Type()) {
+		return d.md.PrimitiveDecode(prim, f.Addr().Interface())
+	}
+
+	switch f.Kind() {
+	case reflect.Pointer:
+		newVal := reflect.New(f.Type().Elem())
+		if err := d.decode(path, newVal.Elem(), prim, ""); err != nil {
+			return err
+		}
+		f.Set(newVal)
+
+	case reflect.Struct:
+		var tbl map[string]toml.Primitive
+		if err := d.md.PrimitiveDecode(prim, &tbl); err != nil {
+			return err
+		}
+		return d.fillStruct(path, tbl, f)
+
+	case reflect.Map:
+		var tbl map[string]toml.Primitive
+		if err := d.md.PrimitiveDecode(prim, &tbl); err != nil {
+			return err
+		}
+
+		if f.IsNil() {
+			f.Set(reflect.MakeMap(f.Type()))
+		}
+
+		for _, k := range sortedKeys(tbl) {
+			elem := reflect.New(f.Type().Elem()).Elem()
+			if err := d.decode(joinPath(path, k), elem, tbl[k], ""); err != nil {
+				return fmt.Errorf("[%s] %w", k, err)
+			}
+			f.SetMapIndex(reflect.ValueOf(k).Convert(f.Type().Key()), elem)
+		}
+
+	case reflect.Slice, reflect.Array:
+		var items []toml.Primitive
+		if err := d.md.PrimitiveDecode(prim, &items); err != nil {
+			return err
+		}
+
+		if f.Kind() == reflect.Slice {
+			f.Set(reflect.MakeSlice(f.Type(), len(items), len(items)))
+		} else if len(items) > f.Len() {
+			return fmt.Errorf("array of %d elements is too long for %s", len(items), f.Type())
+		}
+
+		for i, item := range items {
+			if err := d.decode(fmt.Sprintf("%s[%d]", path, i), f.Index(i), item, ""); err != nil {
+				return fmt.Errorf("[%d] %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// tomlScalar returns string, number or boolean TOML value as a string
+// passed to decoders
+func tomlScalar(raw any) (string, bool) {
+	switch v := raw.(type) {
+	case string:
+		return v, true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case encoding.TextMarshaler:
+		s, err := v.MarshalText()
+		return string(s), err == nil
+	}
+
+	return "", false
+}
+
+// lookupTomlKey finds value for the key in the table. If there is no
+// exact match, key is matched case insensitively, the first of the keys
+// in sorted order wins.
+func lookupTomlKey(tbl map[string]toml.Primitive, name string) (string, toml.Primitive, bool) {
+	if prim, ok := tbl[name]; ok {
+		return name, prim, true
+	}
+
+	for _, key := range sortedKeys(tbl) {
+		if strings.EqualFold(key, name) {
+			return key, tbl[key], true
+		}
+	}
+
+	return "", toml.Primitive{}, false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadToml(t *testing.T) {
+
+	type Section struct {
+		Address string
+		Port    uint16 `toml:"port"`
+	}
+
+	type Embedded struct {
+		Name string
+	}
+
+	type MyStruct struct {
+		Embedded
+
+		Server  Section
+		Servers []Section
+		Tags    map[string]string
+		Ratio   float32
+		Enabled *bool
+		Skipped string `toml:"-"`
+	}
+
+	data := `
+name = "service"
+ratio = 0.5
+enabled = true
+Skipped = "value"
+
+[server]
+address = "127.0.0.1"
+port = 8080
+
+[[servers]]
+address = "a"
+
+[[servers]]
+address = "b"
+
+[tags]
+team = "core"
+`
+
+	fn := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(fn, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := MyStruct{}
+	if err := LoadToml(&s, fn); err != nil {
+		t.Fatalf("LoadToml returned error: %s", err)
+	}
+
+	if s.Name != "service" || s.Ratio != 0.5 || s.Enabled == nil || !*s.Enabled || s.Skipped != "" {
+		t.Errorf("Top level fields contain invalid values: %#v", s)
+	}
+
+	if s.Server.Address != "127.0.0.1" || s.Server.Port != 8080 {
+		t.Errorf("s.Server(%v) contain invalid value", s.Server)
+	}
+
+	if len(s.Servers) != 2 || s.Servers[1].Address != "b" {
+		t.Errorf("s.Servers(%v) contain invalid value", s.Servers)
+	}
+
+	if s.Tags["team"] != "core" {
+		t.Errorf("s.Tags(%v) contain invalid value", s.Tags)
+	}
+
+	if err := os.WriteFile(fn, []byte("[server]\nport = 70000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadToml(&s, fn); err == nil {
+		t.Errorf("Expected overflow error for port")
+	}
+}
+
+func TestLoadTomlDecodingRules(t *testing.T) {
+
+	type Limits struct {
+		Timeout time.Duration
+		Budget  amount
+	}
+
+	type Section struct {
+		Timeout time.Duration
+	}
+
+	// Decoded by toml package as a whole
+	type Plain struct {
+		Timeout time.Duration
+		Limits  map[string]Section
+	}
+
+	// Fields with decoders and aliases are decoded separately, the rest
+	// is decoded by toml package
+	type Decoded struct {
+		Timeout time.Duration `toml:"timeout,alias=request_timeout"`
+		Limits  map[string]Limits
+		Ports   []int `toml:",decoder=csvints"`
+	}
+
+	data := `
+timeout = "5s"
+ports = [80, 443]
+
+[limits.api]
+timeout = "1m"
+budget = { cents = 500 }
+
+[limits.web]
+timeout = "2s"
+budget = "12.50"
+`
+
+	fn := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(fn, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := Plain{}
+	if err := LoadToml(&p, fn); err != nil {
+		t.Fatalf("LoadToml returned error: %s", err)
+	}
+
+	if p.Timeout != 5*time.Second || p.Limits["api"].Timeout != time.Minute {
+		t.Errorf("Invalid values loaded: %+v", p)
+	}
+
+	d := Decoded{}
+	if err := LoadToml(&d, fn); err != nil {
+		t.Fatalf("LoadToml returned error: %s", err)
+	}
+
+	// Tables and arrays are decoded as usual into the fields with
+	// decoders, strings are passed to the decoders
+	expected := Decoded{
+		Timeout: 5 * time.Second,
+		Limits: map[string]Limits{
+			"api": {Timeout: time.Minute, Budget: amount{Cents: 500}},
+			"web": {Timeout: 2 * time.Second, Budget: amount{Cents: 1250}},
+		},
+		Ports: []int{80, 443},
+	}
+
+	if !reflect.DeepEqual(d, expected) {
+		t.Errorf("Invalid values loaded:\n%+v\nExpected:\n%+v", d, expected)
+	}
+}
+
+func TestLoadTomlKeyCase(t *testing.T) {
+	type Config struct {
+		Name string `toml:"name,alias=title"`
+	}
+
+	fn := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(fn, []byte("NAME = \"upper\"\nName = \"mixed\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Key is matched case insensitively in sorted order, whatever
+	// the order of map iteration is
+	for i := 0; i < 10; i++ {
+		cfg := Config{}
+		if err := LoadToml(&cfg, fn); err != nil || cfg.Name != "upper" {
+			t.Fatalf("Expected first key in sorted order to be used, got %q, %v", cfg.Name, err)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ByteSize is a size in bytes which can be configured in human-friendly form,
+// for example "10MiB" or "512KB".
+//
+// Both decimal (KB, MB, GB, TB) and binary (KiB, MiB, GiB, TiB) units are
+// supported. Units are case insensitive. Value without units is in bytes.
+type ByteSize int64
+
+const (
+	Byte ByteSize = 1
+
+	KB ByteSize = 1000
+	MB          = 1000 * KB
+	GB          = 1000 * MB
+	TB          = 1000 * GB
+
+	KiB ByteSize = 1024
+	MiB          = 1024 * KiB
+	GiB          = 1024 * MiB
+	TiB          = 1024 * GiB
+)
+
+var byteUnits = []struct {
+	name string
+	size ByteSize
+}{
+	// Binary units go first, so "10MiB" is printed instead of "10485.76KB"
+	{"TiB", TiB}, {"GiB", GiB}, {"MiB", MiB}, {"KiB", KiB},
+	{"TB", TB}, {"GB", GB}, {"MB", MB}, {"KB", KB},
+	{"B", Byte},
+}
+
+// ParseByteSize parses strings like "10MiB", "1.5GB" or "512"
+func ParseByteSize(s string) (ByteSize, error) {
+	str := strings.TrimSpace(s)
+
+	i := strings.IndexFunc(str, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(str)
+	}
+
+	num, unit := str[:i], strings.TrimSpace(str[i:])
+	if num == "" {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	mult := Byte
+	if unit != "" {
+		found := false
+		for _, u := range byteUnits {
+			if strings.EqualFold(unit, u.name) {
+				mult, found = u.size, true
+				break
+			}
+		}
+
+		if !found {
+			return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, unit)
+		}
+	}
+
+	if n, err := strconv.ParseInt(num, 10, 64); err == nil {
+		if n > math.MaxInt64/int64(mult) {
+			return 0, fmt.Errorf("invalid size %q: value out of range", s)
+		}
+		return ByteSize(n) * mult, nil
+	}
+
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	f *= float64(mult)
+	if f > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: value out of range", s)
+	}
+
+	return ByteSize(f), nil
+}
+
+// Bytes returns size as a number of bytes
+func (b ByteSize) Bytes() int64 {
+	return int64(b)
+}
+
+// String returns size in the largest unit which represents it exactly
+func (b ByteSize) String() string {
+	if b == 0 {
+		return "0B"
+	}
+
+	for _, u := range byteUnits {
+		if b%u.size == 0 {
+			return fmt.Sprintf("%d%s", b/u.size, u.name)
+		}
+	}
+
+	return fmt.Sprintf("%dB", int64(b))
+}
+
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	v, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+
+	*b = v
+	return nil
+}
+
+// UnmarshalTOML accepts size as a string with units or integer number of bytes
+func (b *ByteSize) UnmarshalTOML(v any) error {
+	switch val := v.(type) {
+	case string:
+		return b.UnmarshalText([]byte(val))
+	case int64:
+		*b = ByteSize(val)
+		return nil
+	}
+
+	return fmt.Errorf("invalid size: %v", v)
+}
+
+// Set implements flag.Value
+func (b *ByteSize) Set(s string) error {
+	return b.UnmarshalText([]byte(s))
+}
+
+// Duration is a time.Duration which can be configured either as a string
+// accepted by time.ParseDuration ("1m30s") or integer number of seconds.
+type Duration time.Duration
+
+// ParseDuration parses strings like "1m30s" or "90"
+func ParseDuration(s string) (Duration, error) {
+	s = strings.TrimSpace(s)
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return Duration(time.Duration(n) * time.Second), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	return Duration(d), nil
+}
+
+// Duration returns value as time.Duration
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = v
+	return nil
+}
+
+// UnmarshalTOML accepts duration as a string or integer number of seconds
+func (d *Duration) UnmarshalTOML(v any) error {
+	switch val := v.(type) {
+	case string:
+		return d.UnmarshalText([]byte(val))
+	case int64:
+		*d = Duration(time.Duration(val) * time.Second)
+		return nil
+	case float64:
+		*d = Duration(val * float64(time.Second))
+		return nil
+	}
+
+	return fmt.Errorf("invalid duration: %v", v)
+}
+
+// Set implements flag.Value
+func (d *Duration) Set(s string) error {
+	return d.UnmarshalText([]byte(s))
+}
+
+// Percent is a ratio which can be configured as percentage ("5%")
+// or as a fraction ("0.05"). The value holds a fraction, so "5%" is 0.05.
+//
+// Numbers without "%" greater than 1 are rejected: "5" could mean both
+// 5% and 500%, so ratios above 100% have to be written as "150%".
+type Percent float64
+
+// ParsePercent parses strings like "5%", "12.5%" or "0.05"
+func ParsePercent(s string) (Percent, error) {
+	str := strings.TrimSpace(s)
+
+	percent := strings.HasSuffix(str, "%")
+	if percent {
+		str = strings.TrimSpace(strings.TrimSuffix(str, "%"))
+	}
+
+	if percent {
+		f, err := parseHundredths(str)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, fmt.Errorf("invalid percentage %q", s)
+		}
+		return Percent(f), nil
+	}
+
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid percentage %q", s)
+	}
+
+	return percentFraction(f)
+}
+
+// parseHundredths parses decimal number divided by 100. The decimal
+// exponent is shifted instead of dividing the parsed value, so the result
+// is rounded once and "x%" printed by Percent.String gives back the same
+// value.
+func parseHundredths(s string) (float64, error) {
+	if strings.Contains(strings.ToLower(s), "0x") {
+		f, err := strconv.ParseFloat(s, 64)
+		return f / 100, err
+	}
+
+	mantissa, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		mantissa = s[:i]
+		exp, err = strconv.Atoi(s[i+1:])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return strconv.ParseFloat(mantissa+"e"+strconv.Itoa(exp-2), 64)
+}
+
+// percentFraction returns Percent for the number without "%"
+func percentFraction(f float64) (Percent, error) {
+	if math.Abs(f) > 1 {
+		return 0, fmt.Errorf("ambiguous percentage %v, use \"%v%%\" or a fraction like 0.05", f, f)
+	}
+
+	return Percent(f), nil
+}
+
+// Fraction returns value as a fraction, i.e. 0.05 for "5%"
+func (p Percent) Fraction() float64 {
+	return float64(p)
+}
+
+// String prints the shortest decimal form of the fraction with the point
+// moved by two digits, so 0.07 is printed as "7%" rather than
+// "7.000000000000001%", and parsing the result gives back the same value
+func (p Percent) String() string {
+	f := float64(p)
+	if f == 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f*100, 'f', -1, 64) + "%"
+	}
+
+	// d.ddddde±xx
+	e := strconv.FormatFloat(f, 'e', -1, 64)
+	sign := ""
+	if e[0] == '-' {
+		sign, e = "-", e[1:]
+	}
+
+	i := strings.IndexByte(e, 'e')
+	exp, _ := strconv.Atoi(e[i+1:])
+	digits := strings.Replace(e[:i], ".", "", 1)
+
+	// Number of digits before the point in hundredths
+	point := exp + 1 + 2
+
+	var res string
+	switch {
+	case point <= 0:
+		res = "0." + strings.Repeat("0", -point) + digits
+	case point >= len(digits):
+		res = digits + strings.Repeat("0", point-len(digits))
+	default:
+		res = digits[:point] + "." + digits[point:]
+	}
+
+	return sign + res + "%"
+}
+
+func (p Percent) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Percent) UnmarshalText(text []byte) error {
+	v, err := ParsePercent(string(text))
+	if err != nil {
+		return err
+	}
+
+	*p = v
+	return nil
+}
+
+// UnmarshalTOML accepts percentage as a string or a number holding fraction
+func (p *Percent) UnmarshalTOML(v any) error {
+	switch val := v.(type) {
+	case string:
+		return p.UnmarshalText([]byte(val))
+	case float64:
+		return p.setFraction(val)
+	case int64:
+		return p.setFraction(float64(val))
+	}
+
+	return fmt.Errorf("invalid percentage: %v", v)
+}
+
+func (p *Percent) setFraction(f float64) error {
+	v, err := percentFraction(f)
+	if err != nil {
+		return err
+	}
+
+	*p = v
+	return nil
+}
+
+// Set implements flag.Value
+func (p *Percent) Set(s string) error {
+	return p.UnmarshalText([]byte(s))
+}
+
+// List is a list of strings which can be configured as a comma-separated
+// string ("a, b, c") or, in TOML, as an array of strings
+type List []string
+
+// ParseList splits comma-separated string, trimming spaces around values.
+// Empty values are skipped.
+func ParseList(s string) List {
+	var l List
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+func (l List) String() string {
+	return strings.Join(l, ",")
+}
+
+func (l List) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *List) UnmarshalText(text []byte) error {
+	*l = ParseList(string(text))
+	return nil
+}
+
+// UnmarshalTOML accepts list as a comma-separated string or an array of strings
+func (l *List) UnmarshalTOML(v any) error {
+	switch val := v.(type) {
+	case string:
+		return l.UnmarshalText([]byte(val))
+	case []any:
+		res := make(List, 0, len(val))
+		for _, item := range val {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("invalid list item: %v", item)
+			}
+			res = append(res, s)
+		}
+		*l = res
+		return nil
+	}
+
+	return fmt.Errorf("invalid list: %v", v)
+}
+
+// Set implements flag.Value
+func (l *List) Set(s string) error {
+	return l.UnmarshalText([]byte(s))
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+
+	testCases := map[string]ByteSize{
+		"512":    512,
+		"512B":   512,
+		"512KB":  512000,
+		"10MiB":  10485760,
+		"10 mib": 10485760,
+		"1.5GB":  1500000000,
+		"2TiB":   2 * TiB,
+	}
+
+	for s, expected := range testCases {
+		v, err := ParseByteSize(s)
+		if err != nil {
+			t.Fatalf("Error parsing %q: %s", s, err)
+		}
+		if v != expected {
+			t.Errorf("Parsing %q returned %d, expected %d", s, v, expected)
+		}
+	}
+
+	for _, s := range []string{"", "MB", "10XB", "-1KB"} {
+		if _, err := ParseByteSize(s); err == nil {
+			t.Errorf("Expected error parsing %q", s)
+		}
+	}
+
+	if s := ByteSize(10485760).String(); s != "10MiB" {
+		t.Errorf("ByteSize(10485760) printed as %q, expected 10MiB", s)
+	}
+
+	if s := ByteSize(1500000).String(); s != "1500KB" {
+		t.Errorf("ByteSize(1500000) printed as %q, expected 1500KB", s)
+	}
+}
+
+func TestParsePercent(t *testing.T) {
+
+	testCases := map[string]Percent{
+		"5%":    0.05,
+		"12.5%": 0.125,
+		"0.3":   0.3,
+	}
+
+	for s, expected := range testCases {
+		v, err := ParsePercent(s)
+		if err != nil {
+			t.Fatalf("Error parsing %q: %s", s, err)
+		}
+		if v != expected {
+			t.Errorf("Parsing %q returned %v, expected %v", s, v, expected)
+		}
+	}
+
+	// Bare numbers above 1 could be both percentage and fraction
+	for _, s := range []string{"5", "-2", "150"} {
+		if _, err := ParsePercent(s); err == nil {
+			t.Errorf("Expected error parsing ambiguous %q", s)
+		}
+	}
+
+	if v, err := ParsePercent("150%"); err != nil || v != 1.5 {
+		t.Errorf("Parsing 150%% returned %v, %v", v, err)
+	}
+
+	printed := map[Percent]string{
+		0.05:    "5%",
+		0.07:    "7%",
+		0.29:    "29%",
+		0.125:   "12.5%",
+		0.00001: "0.001%",
+		1.5:     "150%",
+	}
+
+	for p, expected := range printed {
+		if s := p.String(); s != expected {
+			t.Errorf("Percent(%v) printed as %q, expected %s", float64(p), s, expected)
+		}
+	}
+}
+
+func TestPercentRoundTrip(t *testing.T) {
+	values := []Percent{0, -0.05, 0.123456789012, 0.11898754703348247, 9.045862893438474e-07, 1e-20, 12345.678, 1.5}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		values = append(values, Percent(rnd.Float64()), Percent(rnd.Float64()*1e-6))
+	}
+
+	for _, p := range values {
+		text, err := p.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText returned error: %s", err)
+		}
+
+		var res Percent
+		if err := res.UnmarshalText(text); err != nil || res != p {
+			t.Fatalf("Percent(%v) printed as %q is parsed as %v, %v", float64(p), text, float64(res), err)
+		}
+	}
+
+	type Doc struct {
+		Rate Percent
+	}
+
+	// Export is read back by LoadToml
+	in := Doc{Rate: 0.123456789012}
+	var buf bytes.Buffer
+	if err := Export(&buf, in, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	fn := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(fn, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out Doc
+	if err := LoadToml(&out, fn); err != nil || out != in {
+		t.Errorf("Percent is changed by Export and LoadToml: %v, %v", float64(out.Rate), err)
+	}
+}
+
+func TestHumanTypesFromSources(t *testing.T) {
+
+	type MyStruct struct {
+		Size    ByteSize `env:"HT_SIZE"`
+		Timeout Duration `env:"HT_TIMEOUT"`
+		Idle    Duration `env:"HT_IDLE"`
+		Rate    Percent  `env:"HT_RATE"`
+		Hosts   List     `env:"HT_HOSTS"`
+	}
+
+	data := "Size = \"10MiB\"\nTimeout = 30\nIdle = \"1m30s\"\nRate = \"5%\"\nHosts = [\"a\", \"b\"]\n"
+	fn := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(fn, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := MyStruct{}
+	if err := LoadToml(&s, fn); err != nil {
+		t.Fatalf("LoadToml returned error: %s", err)
+	}
+
+	if s.Size != 10*MiB || s.Timeout.Duration() != 30*time.Second ||
+		s.Idle.Duration() != 90*time.Second || s.Rate != 0.05 || s.Hosts.String() != "a,b" {
+		t.Errorf("Loaded from TOML invalid values: %v", s)
+	}
+
+	os.Setenv("HT_SIZE", "512KB")
+	os.Setenv("HT_TIMEOUT", "10")
+	os.Setenv("HT_RATE", "10%")
+	os.Setenv("HT_HOSTS", " c, ,d ")
+	defer func() {
+		os.Unsetenv("HT_SIZE")
+		os.Unsetenv("HT_TIMEOUT")
+		os.Unsetenv("HT_RATE")
+		os.Unsetenv("HT_HOSTS")
+	}()
+
+	if err := LoadOverrides(&s); err != nil {
+		t.Fatalf("LoadOverrides returned error: %s", err)
+	}
+
+	if s.Size != 512*KB || s.Timeout.Duration() != 10*time.Second || s.Rate != 0.1 ||
+		!reflect.DeepEqual(s.Hosts, List{"c", "d"}) {
+		t.Errorf("Loaded from env invalid values: %v", s)
+	}
+
+	os.Setenv("HT_SIZE", "lots")
+	if err := LoadOverrides(&s); err == nil {
+		t.Errorf("Expected error for invalid size")
+	}
+}
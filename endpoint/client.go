@@ -2,11 +2,14 @@ package endpoint
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 )
 
@@ -14,6 +17,10 @@ import (
 type RESTClient struct {
 	httpClient http.Client
 
+	// HTTPClient is used instead of the default client if set,
+	// for example to trust additional CAs (see NewTLSClient)
+	HTTPClient *http.Client
+
 	// Function which will construct errors can be overriden
 	ErrParser func(*http.Response, []byte) error
 
@@ -125,7 +132,12 @@ func (c *RESTClient) parseError(resp *http.Response, reqBody []byte) error {
 
 func (c *RESTClient) do(req *http.Request, furl string, res any) error {
 
-	resp, err := c.httpClient.Do(req)
+	client := c.HTTPClient
+	if client == nil {
+		client = &c.httpClient
+	}
+
+	resp, err := client.Do(req)
 
 	if err != nil {
 		return fmt.Errorf("error creating request for %q: %w", furl, err)
@@ -156,3 +168,27 @@ func (c *RESTClient) do(req *http.Request, furl string, res any) error {
 	}
 	return nil
 }
+
+// NewTLSClient returns HTTP client which trusts CAs from PEM file caFile
+// in addition to the system ones, for example the CA of the development
+// certificates (see common.ServerConfig.DevTLS)
+func NewTLSClient(caFile string) (*http.Client, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CA file: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %q", caFile)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -2,13 +2,11 @@ package endpoint
 
 import (
 	"context"
-	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
-const testAddr = "localhost:53312"
-
 type someStruct struct {
 	Res string
 }
@@ -26,10 +24,10 @@ func TestErrorsWrapper(t *testing.T) {
 		return someStruct{Res: "test-string"}, nil
 	}))
 
-	srv := http.Server{Addr: testAddr, Handler: mux}
-	go srv.ListenAndServe()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
 
-	api := RESTClient{BaseURL: fmt.Sprintf("http://%s/", testAddr)}
+	api := RESTClient{BaseURL: srv.URL + "/"}
 
 	var res = someStruct{}
 	err := api.Get(context.Background(), "err", &res)
@@ -47,7 +45,6 @@ func TestErrorsWrapper(t *testing.T) {
 	if res.Res != "test-string" {
 		t.Fatalf("Invalid result received: %s (expected test-string)", res.Res)
 	}
-	srv.Close()
 }
 
 func TestErrors(t *testing.T) {
@@ -63,10 +60,10 @@ func TestErrors(t *testing.T) {
 		Success(w, succResult)
 	})
 
-	srv := http.Server{Addr: testAddr, Handler: mux}
-	go srv.ListenAndServe()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
 
-	api := RESTClient{BaseURL: fmt.Sprintf("http://%s/", testAddr)}
+	api := RESTClient{BaseURL: srv.URL + "/"}
 
 	res := someStruct{}
 
@@ -87,6 +84,4 @@ func TestErrors(t *testing.T) {
 	if res.Res != "Some-string" {
 		t.Fatalf("Unexpected result. Got: %s, expected: Some-string", res.Res)
 	}
-
-	srv.Close()
 }
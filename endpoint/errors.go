@@ -0,0 +1,154 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// InternalError is written for errors which are neither ApiErrors nor
+// mapped to them by ErrorHandler, so internal details are not exposed.
+// ErrId is set, so RESTClient recognizes it as ApiError.
+var InternalError = ApiError{
+	HttpStatus: http.StatusInternalServerError,
+	ErrId:      http.StatusInternalServerError,
+	Message:    "Internal server error",
+}
+
+// StatusClientClosedRequest is the status of the requests cancelled by
+// the client (nginx convention), it's never seen by the client itself
+const StatusClientClosedRequest = 499
+
+// CanceledError is written for context.Canceled not mapped by
+// ErrorHandler, usually caused by the client closing connection.
+// It's not reported.
+var CanceledError = ApiError{
+	HttpStatus: StatusClientClosedRequest,
+	ErrId:      StatusClientClosedRequest,
+	Message:    "Request cancelled",
+}
+
+// ErrorHandler writes errors returned by HandlerFuncWithData and
+// HandlerFuncWithError as ApiErrors:
+//
+//   - ApiError is written as is, also when it's wrapped
+//     (fmt.Errorf("...: %w", apiErr))
+//   - other errors are converted with the mappings, in order of registration
+//   - CanceledError is written for context.Canceled if no mapping matches
+//   - InternalError is written for other errors if no mapping matches
+//
+// Errors resulting in 5xx responses are passed to Report.
+//
+//	errs := &endpoint.ErrorHandler{Report: sentryReport}
+//	errs.Map(sql.ErrNoRows, endpoint.ApiError{HttpStatus: 404, ErrId: 1004, Message: "Not found"})
+//	errs.MapFunc(func(err error) (endpoint.ApiError, bool) {
+//		var fe config.FieldError
+//		if errors.As(err, &fe) {
+//			return endpoint.ApiError{HttpStatus: 400, ErrId: 1001, Message: fe.Error()}, true
+//		}
+//		return endpoint.ApiError{}, false
+//	})
+//
+//	handler := endpoint.WithErrorHandler(mux, errs)
+type ErrorHandler struct {
+	// Report is called with the original error when the response is 5xx,
+	// for example to send it to error tracking. Error is logged if not set.
+	Report func(r *http.Request, err error)
+
+	mu       sync.RWMutex
+	mappings []func(error) (ApiError, bool)
+}
+
+// DefaultErrorHandler is used for the handlers not wrapped with
+// WithErrorHandler
+var DefaultErrorHandler = &ErrorHandler{}
+
+// Map registers ApiError written for errors matching target (see errors.Is)
+func (h *ErrorHandler) Map(target error, apiErr ApiError) {
+	h.MapFunc(func(err error) (ApiError, bool) {
+		return apiErr, errors.Is(err, target)
+	})
+}
+
+// MapFunc registers function converting errors to ApiErrors, it returns
+// false for the errors it doesn't handle
+func (h *ErrorHandler) MapFunc(fn func(err error) (ApiError, bool)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.mappings = append(h.mappings, fn)
+}
+
+// ApiError returns ApiError written for err
+func (h *ErrorHandler) ApiError(err error) ApiError {
+	var apiErr ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, fn := range h.mappings {
+		if apiErr, ok := fn(err); ok {
+			return apiErr
+		}
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return CanceledError
+	}
+
+	return InternalError
+}
+
+// Handle writes err to the response and reports it, if necessary
+func (h *ErrorHandler) Handle(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := h.ApiError(err)
+	if apiErr.HttpStatus == 0 {
+		apiErr.HttpStatus = http.StatusInternalServerError
+	}
+
+	if apiErr.HttpStatus >= 500 {
+		h.report(r, err)
+	}
+
+	// Nothing meaningful can be done if the client has gone
+	_ = WriteApiError(w, apiErr)
+}
+
+func (h *ErrorHandler) report(r *http.Request, err error) {
+	if h.Report != nil {
+		h.Report(r, err)
+		return
+	}
+
+	log.Printf("%s %s: %s", r.Method, r.URL.Path, err)
+}
+
+type errorHandlerKey struct{}
+
+// WithErrorHandler returns handler which uses h for the errors of
+// HandlerFuncWithData and HandlerFuncWithError called by next, instead
+// of DefaultErrorHandler
+func WithErrorHandler(next http.Handler, h *ErrorHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), errorHandlerKey{}, h)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// errorHandler returns error handler of the request
+func errorHandler(r *http.Request) *ErrorHandler {
+	if h, ok := r.Context().Value(errorHandlerKey{}).(*ErrorHandler); ok {
+		return h
+	}
+	return DefaultErrorHandler
+}
+
+// handleError writes err with the error handler of the request
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+	errorHandler(r).Handle(w, r, err)
+}
@@ -0,0 +1,123 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var errNotFound = errors.New("record not found")
+
+type validationError struct {
+	Field string
+}
+
+func (e validationError) Error() string {
+	return fmt.Sprintf("%s is invalid", e.Field)
+}
+
+// failing returns handler which fails with err
+func failing(err error) http.Handler {
+	return HandlerFuncWithError(func(w http.ResponseWriter, r *http.Request) error {
+		return err
+	})
+}
+
+func serveError(h http.Handler) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/items/1", nil))
+	return w
+}
+
+func TestErrorHandler(t *testing.T) {
+	var reported []error
+	errs := &ErrorHandler{Report: func(r *http.Request, err error) {
+		reported = append(reported, err)
+	}}
+
+	errs.Map(errNotFound, ApiError{HttpStatus: http.StatusNotFound, ErrId: 1004, Message: "Not found"})
+	errs.Map(context.Canceled, ApiError{HttpStatus: 499, ErrId: 1099, Message: "Request cancelled"})
+	errs.MapFunc(func(err error) (ApiError, bool) {
+		var ve validationError
+		if errors.As(err, &ve) {
+			return ApiError{HttpStatus: http.StatusBadRequest, ErrId: 1001, Message: ve.Error()}, true
+		}
+		return ApiError{}, false
+	})
+
+	secret := errors.New("dial tcp 10.0.0.5:5432: connection refused")
+
+	tests := []struct {
+		err      error
+		status   int
+		apiErr   ApiError
+		reported bool
+	}{
+		{errInvalidCredentials, 403, errInvalidCredentials, false},
+		{fmt.Errorf("login: %w", errInvalidCredentials), 403, errInvalidCredentials, false},
+		{fmt.Errorf("load item: %w", errNotFound), 404, ApiError{ErrId: 1004, Message: "Not found"}, false},
+		{context.Canceled, 499, ApiError{ErrId: 1099, Message: "Request cancelled"}, false},
+		{fmt.Errorf("create: %w", validationError{"name"}), 400, ApiError{ErrId: 1001, Message: "name is invalid"}, false},
+		{secret, 500, InternalError, true},
+		{ApiError{ErrId: 1, Message: "no status"}, 500, ApiError{ErrId: 1, Message: "no status"}, true},
+	}
+
+	for _, tt := range tests {
+		reported = nil
+
+		w := serveError(WithErrorHandler(failing(tt.err), errs))
+
+		if w.Code != tt.status {
+			t.Errorf("%v: expected status %d, got %d", tt.err, tt.status, w.Code)
+		}
+
+		var got ApiError
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%v: invalid response %q: %s", tt.err, w.Body.String(), err)
+		}
+
+		if got.ErrId != tt.apiErr.ErrId || got.Message != tt.apiErr.Message {
+			t.Errorf("%v: expected %+v, got %+v", tt.err, tt.apiErr, got)
+		}
+
+		if tt.reported != (len(reported) == 1 && reported[0] == tt.err) {
+			t.Errorf("%v: expected reported=%v, got %v", tt.err, tt.reported, reported)
+		}
+	}
+
+	reported = nil
+	w := serveError(WithErrorHandler(failing(fmt.Errorf("query: %w", context.Canceled)), &ErrorHandler{Report: errs.Report}))
+	if w.Code != StatusClientClosedRequest || len(reported) != 0 {
+		t.Errorf("Expected unmapped context.Canceled to be 499 and not reported, got %d, reported %v", w.Code, reported)
+	}
+
+	w = serveError(failing(secret))
+	if strings.Contains(w.Body.String(), "10.0.0.5") {
+		t.Errorf("Internal error details are exposed: %s", w.Body.String())
+	}
+}
+
+func TestDefaultErrorHandler(t *testing.T) {
+	defer func(h *ErrorHandler) { DefaultErrorHandler = h }(DefaultErrorHandler)
+
+	DefaultErrorHandler = &ErrorHandler{}
+	DefaultErrorHandler.Map(errNotFound, ApiError{HttpStatus: http.StatusNotFound, Message: "Not found"})
+
+	h := HandlerFuncWithData(func(w http.ResponseWriter, r *http.Request) (any, error) {
+		return nil, errNotFound
+	})
+
+	if w := serveError(h); w.Code != http.StatusNotFound {
+		t.Errorf("Expected global mapping to be used, got %d", w.Code)
+	}
+
+	// Handler of the mux takes precedence
+	if w := serveError(WithErrorHandler(h, &ErrorHandler{Report: func(*http.Request, error) {}})); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected mux error handler to be used, got %d", w.Code)
+	}
+}
@@ -0,0 +1,207 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fednep/goapilib/config/common"
+)
+
+// Group runs several servers with shared lifecycle, for example public API,
+// plain HTTP listener redirecting to it and admin port bound to localhost:
+//
+//	type Config struct {
+//		Servers map[string]common.ServerConfig `toml:"servers"`
+//	}
+//
+//	g, err := endpoint.NewGroup(cfg.Servers, map[string]http.Handler{
+//		"api":      endpoint.HSTS(api, 365*24*time.Hour, false),
+//		"redirect": endpoint.RedirectHTTPS(443),
+//		"admin":    adminMux,
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	err = g.Serve(ctx)
+type Group struct {
+	Servers map[string]*Server
+
+	mu     sync.Mutex
+	hooks  []func(context.Context) error
+	checks []func(context.Context) error
+}
+
+// NewGroup creates group of servers from configuration sections and
+// handlers with the same names
+func NewGroup(configs map[string]common.ServerConfig, handlers map[string]http.Handler) (*Group, error) {
+	g := &Group{Servers: map[string]*Server{}}
+
+	for name, cfg := range configs {
+		handler, ok := handlers[name]
+		if !ok {
+			return nil, fmt.Errorf("no handler for server %q", name)
+		}
+
+		g.Servers[name] = &Server{Config: cfg, Handler: handler}
+	}
+
+	for name := range handlers {
+		if _, ok := configs[name]; !ok {
+			return nil, fmt.Errorf("no configuration for server %q", name)
+		}
+	}
+
+	return g, nil
+}
+
+// OnShutdown registers a function which is called after all servers of
+// the group are stopped, see Server.OnShutdown
+func (g *Group) OnShutdown(fn func(ctx context.Context) error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.hooks = append(g.hooks, fn)
+}
+
+// OnHealthCheck registers a function which is called before each
+// watchdog ping, in addition to the health checks of the servers,
+// see Server.OnHealthCheck
+func (g *Group) OnHealthCheck(fn func(ctx context.Context) error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.checks = append(g.checks, fn)
+}
+
+// Serve starts all servers of the group and blocks until they are stopped.
+//
+// Listeners are opened before any server is started, if one of them can't
+// be opened the others are closed and the error is returned. When one of
+// the servers fails, ctx is done or SIGINT/SIGTERM is received, all the
+// servers are shut down gracefully (see Server.Serve). Shutdown hooks of
+// the group are called after that.
+//
+// Under systemd, "READY=1" is sent once all servers are started, see
+// Server.Serve.
+//
+// Returns nil if all servers were stopped cleanly, otherwise the first
+// error prefixed with the name of the server.
+func (g *Group) Serve(ctx context.Context) error {
+	if len(g.Servers) == 0 {
+		return errors.New("no servers in the group")
+	}
+
+	names := make([]string, 0, len(g.Servers))
+	for name := range g.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	listeners := make([]net.Listener, 0, len(names))
+	for _, name := range names {
+		ln := g.Servers[name].Listener
+		if ln == nil {
+			var err error
+			ln, err = g.Servers[name].Config.Listen()
+			if err != nil {
+				for _, ln := range listeners {
+					ln.Close()
+				}
+				return fmt.Errorf("server %q: %w", name, err)
+			}
+		}
+
+		listeners = append(listeners, ln)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		name string
+		err  error
+	}
+
+	addrs := make([]string, len(names))
+	for i, name := range names {
+		addrs[i] = name + " on " + listeners[i].Addr().String()
+	}
+	status := "Serving " + strings.Join(addrs, ", ")
+
+	pending := int32(len(names))
+	ready := func() {
+		if atomic.AddInt32(&pending, -1) == 0 {
+			notify("READY=1", "STATUS="+status)
+			go watchdog(ctx, status, g.healthChecks)
+		}
+	}
+
+	results := make(chan result, len(names))
+	for i, name := range names {
+		go func(name string, srv *Server, ln net.Listener) {
+			err := srv.serve(ctx, ln, ready)
+			if err != nil {
+				// The rest of the group is stopped as well
+				cancel()
+			}
+			results <- result{name, err}
+		}(name, g.Servers[name], listeners[i])
+	}
+
+	var err error
+	for range names {
+		res := <-results
+		if res.err != nil && err == nil {
+			err = fmt.Errorf("server %q: %w", res.name, res.err)
+		}
+	}
+
+	// Hooks get as much time as the slowest server
+	var timeout time.Duration
+	for _, srv := range g.Servers {
+		if t := shutdownTimeout(srv.Config); t > timeout {
+			timeout = t
+		}
+	}
+
+	hookCtx, hookCancel := context.WithTimeout(context.Background(), timeout)
+	defer hookCancel()
+
+	g.mu.Lock()
+	hooks := append([]func(context.Context) error{}, g.hooks...)
+	g.mu.Unlock()
+
+	if hookErr := runHooks(hookCtx, hooks); err == nil {
+		err = hookErr
+	}
+
+	if err != nil {
+		log.Printf("Server group stopped: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// healthChecks returns health checks of the group and all its servers
+func (g *Group) healthChecks() []func(context.Context) error {
+	g.mu.Lock()
+	checks := append([]func(context.Context) error{}, g.checks...)
+	g.mu.Unlock()
+
+	for _, srv := range g.Servers {
+		checks = append(checks, srv.healthChecks()...)
+	}
+
+	return checks
+}
@@ -0,0 +1,155 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fednep/goapilib/config/common"
+)
+
+func testListener(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %s", err)
+	}
+	return ln
+}
+
+func textHandler(text string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, text)
+	})
+}
+
+func TestNewGroup(t *testing.T) {
+	configs := map[string]common.ServerConfig{
+		"api":   {Port: 8080},
+		"admin": {Address: "127.0.0.1", Port: 9090},
+	}
+
+	g, err := NewGroup(configs, map[string]http.Handler{
+		"api":   textHandler("api"),
+		"admin": textHandler("admin"),
+	})
+	if err != nil {
+		t.Fatalf("NewGroup: %s", err)
+	}
+
+	if len(g.Servers) != 2 || g.Servers["admin"].Config.Port != 9090 {
+		t.Errorf("Unexpected servers: %+v", g.Servers)
+	}
+
+	if _, err := NewGroup(configs, map[string]http.Handler{"api": textHandler("api")}); err == nil {
+		t.Errorf("Expected error for server without handler")
+	}
+
+	if _, err := NewGroup(map[string]common.ServerConfig{"api": {Port: 8080}}, map[string]http.Handler{
+		"api":   textHandler("api"),
+		"admin": textHandler("admin"),
+	}); err == nil {
+		t.Errorf("Expected error for handler without configuration")
+	}
+}
+
+func TestGroupServe(t *testing.T) {
+	api, admin := testListener(t), testListener(t)
+
+	g := &Group{Servers: map[string]*Server{
+		"api":   {Config: common.ServerConfig{Port: 8080}, Handler: textHandler("api"), Listener: api},
+		"admin": {Config: common.ServerConfig{Port: 9090}, Handler: textHandler("admin"), Listener: admin},
+	}}
+
+	var order []string
+	g.Servers["api"].OnShutdown(func(ctx context.Context) error {
+		order = append(order, "api")
+		return nil
+	})
+	g.OnShutdown(func(ctx context.Context) error {
+		order = append(order, "group")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- g.Serve(ctx) }()
+
+	for name, ln := range map[string]net.Listener{"api": api, "admin": admin} {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/")
+		if err != nil {
+			t.Fatalf("GET %s: %s", name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(body) != name {
+			t.Errorf("Expected %q from %s server, got %q", name, name, body)
+		}
+	}
+
+	cancel()
+
+	if err := <-serveErr; err != nil {
+		t.Errorf("Expected clean stop, got %s", err)
+	}
+
+	if fmt.Sprint(order) != "[api group]" {
+		t.Errorf("Expected group hooks after server hooks, got %v", order)
+	}
+
+	for _, ln := range []net.Listener{api, admin} {
+		if _, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+			t.Errorf("Expected %s to stop accepting connections", ln.Addr())
+		}
+	}
+}
+
+func TestGroupBindError(t *testing.T) {
+	busy := testListener(t)
+	defer busy.Close()
+
+	other := testListener(t)
+
+	g := &Group{Servers: map[string]*Server{
+		"api": {
+			Config:  common.ServerConfig{Address: "127.0.0.1", Port: busy.Addr().(*net.TCPAddr).Port},
+			Handler: textHandler("api"),
+		},
+		"admin": {Config: common.ServerConfig{Port: 9090}, Handler: textHandler("admin"), Listener: other},
+	}}
+
+	err := g.Serve(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `server "api"`) {
+		t.Fatalf("Expected bind error of the api server, got %v", err)
+	}
+
+	if _, err := net.Dial("tcp", other.Addr().String()); err == nil {
+		t.Errorf("Expected listeners of the other servers to be closed")
+	}
+}
+
+func TestGroupServerFailure(t *testing.T) {
+	api, admin := testListener(t), testListener(t)
+
+	g := &Group{Servers: map[string]*Server{
+		"api": {
+			Config:   common.ServerConfig{Port: 8443, UseTLS: true, CertFile: "missing.pem", KeyFile: "missing.key"},
+			Handler:  textHandler("api"),
+			Listener: api,
+		},
+		"admin": {Config: common.ServerConfig{Port: 9090}, Handler: textHandler("admin"), Listener: admin},
+	}}
+
+	err := g.Serve(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `server "api"`) {
+		t.Fatalf("Expected error of the api server, got %v", err)
+	}
+
+	if _, err := net.Dial("tcp", admin.Addr().String()); err == nil {
+		t.Errorf("Expected the other servers to be stopped")
+	}
+}
@@ -0,0 +1,111 @@
+package endpoint
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notify sends state changes to systemd (see sd_notify(3)) over the
+// socket from NOTIFY_SOCKET environment variable, for example:
+//
+//	endpoint.Notify("STATUS=Migrating database")
+//
+// Server and Group send "READY=1" when they start serving, "STOPPING=1"
+// on shutdown and "WATCHDOG=1" pings (see WatchdogInterval), so units
+// can use Type=notify and WatchdogSec=.
+//
+// Does nothing if NOTIFY_SOCKET is not set.
+func Notify(state ...string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+
+	// Names starting with "@" are in the abstract namespace
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(strings.Join(state, "\n")))
+	return err
+}
+
+// WatchdogInterval returns how often "WATCHDOG=1" should be sent to
+// systemd: half of WATCHDOG_USEC, or 0 if watchdog is not enabled for
+// the process.
+func WatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// notify sends state to systemd and logs the error, if any
+func notify(state ...string) {
+	if err := Notify(state...); err != nil {
+		log.Printf("Cannot notify systemd: %s", err)
+	}
+}
+
+// watchdog pings systemd every WatchdogInterval while all health checks
+// pass, until ctx is done. If a check fails, pings are stopped, so
+// systemd restarts the service unless the check recovers in time.
+func watchdog(ctx context.Context, status string, checks func() []func(context.Context) error) {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	healthy := true
+	for {
+		err := runChecks(ctx, interval, checks())
+
+		switch {
+		case err != nil && ctx.Err() == nil:
+			log.Printf("Health check failed: %s", err)
+			notify("STATUS=Health check failed: " + err.Error())
+		case err == nil && !healthy:
+			notify("WATCHDOG=1", "STATUS="+status)
+		case err == nil:
+			notify("WATCHDOG=1")
+		}
+		healthy = err == nil
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runChecks calls health checks with the context limited by timeout
+// and returns the first error
+func runChecks(ctx context.Context, timeout time.Duration, checks []func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for _, check := range checks {
+		if err := check(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
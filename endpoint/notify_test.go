@@ -0,0 +1,188 @@
+//go:build !windows
+
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fednep/goapilib/config/common"
+)
+
+// listenNotify creates socket receiving notifications sent with Notify
+func listenNotify(t *testing.T) <-chan string {
+	dir, err := os.MkdirTemp("", "notify")
+	if err != nil {
+		t.Fatalf("Cannot create dir: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	fn := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: fn, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Cannot listen: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	t.Setenv("NOTIFY_SOCKET", fn)
+
+	messages := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				close(messages)
+				return
+			}
+			messages <- string(buf[:n])
+		}
+	}()
+
+	return messages
+}
+
+// waitNotify returns messages received until one with the prefix
+func waitNotify(t *testing.T, messages <-chan string, prefix string) []string {
+	t.Helper()
+
+	var received []string
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-messages:
+			received = append(received, msg)
+			if strings.HasPrefix(msg, prefix) {
+				return received
+			}
+		case <-timeout:
+			t.Fatalf("No %q message received, got %q", prefix, received)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := Notify("READY=1"); err != nil {
+		t.Errorf("Expected Notify to do nothing without NOTIFY_SOCKET, got %s", err)
+	}
+
+	messages := listenNotify(t)
+
+	if err := Notify("READY=1", "STATUS=Started"); err != nil {
+		t.Fatalf("Notify: %s", err)
+	}
+
+	if msg := <-messages; msg != "READY=1\nSTATUS=Started" {
+		t.Errorf("Unexpected message: %q", msg)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := []struct {
+		usec, pid string
+		interval  time.Duration
+	}{
+		{"", "", 0},
+		{"invalid", "", 0},
+		{"10000000", "", 5 * time.Second},
+		{"10000000", pid, 5 * time.Second},
+		{"10000000", "1", 0},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("WATCHDOG_USEC", tt.usec)
+		t.Setenv("WATCHDOG_PID", tt.pid)
+
+		if interval := WatchdogInterval(); interval != tt.interval {
+			t.Errorf("WATCHDOG_USEC=%q WATCHDOG_PID=%q: expected %s, got %s", tt.usec, tt.pid, tt.interval, interval)
+		}
+	}
+}
+
+func TestServerNotify(t *testing.T) {
+	messages := listenNotify(t)
+	t.Setenv("WATCHDOG_USEC", "20000")
+
+	ln := testListener(t)
+	srv := Server{Config: common.ServerConfig{Port: 8080}, Handler: textHandler("ok"), Listener: ln}
+
+	// The first checks fail, then the service recovers
+	var calls int32
+	srv.OnHealthCheck(func(ctx context.Context) error {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			return errors.New("database is down")
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ctx) }()
+
+	status := "STATUS=Serving on " + ln.Addr().String()
+
+	received := waitNotify(t, messages, "READY=1")
+	if received[0] != "READY=1\n"+status {
+		t.Errorf("Unexpected ready message: %q", received[0])
+	}
+
+	received = waitNotify(t, messages, "WATCHDOG=1")
+	if received[0] != "STATUS=Health check failed: database is down" {
+		t.Errorf("Expected failed health check to be reported, got %q", received)
+	}
+	if last := received[len(received)-1]; last != "WATCHDOG=1\n"+status {
+		t.Errorf("Expected status to be restored after recovery, got %q", last)
+	}
+
+	waitNotify(t, messages, "WATCHDOG=1")
+
+	cancel()
+	waitNotify(t, messages, "STOPPING=1")
+
+	if err := <-serveErr; err != nil {
+		t.Errorf("Expected clean stop, got %s", err)
+	}
+}
+
+func TestGroupNotify(t *testing.T) {
+	messages := listenNotify(t)
+
+	g := &Group{Servers: map[string]*Server{
+		"api":   {Config: common.ServerConfig{Port: 8080}, Handler: textHandler("api"), Listener: testListener(t)},
+		"admin": {Config: common.ServerConfig{Port: 9090}, Handler: textHandler("admin"), Listener: testListener(t)},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- g.Serve(ctx) }()
+
+	received := waitNotify(t, messages, "READY=1")
+	if len(received) != 1 || !strings.Contains(received[0], "STATUS=Serving admin on ") {
+		t.Errorf("Unexpected messages: %q", received)
+	}
+
+	cancel()
+
+	// Each server reports stopping
+	received = append(waitNotify(t, messages, "STOPPING=1"), waitNotify(t, messages, "STOPPING=1")...)
+	for _, msg := range received {
+		if strings.HasPrefix(msg, "READY=1") {
+			t.Errorf("Expected single READY=1, got %q", received)
+		}
+	}
+
+	if err := <-serveErr; err != nil {
+		t.Errorf("Expected clean stop, got %s", err)
+	}
+}
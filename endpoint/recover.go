@@ -0,0 +1,111 @@
+package endpoint
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+)
+
+// PanicError is passed to ErrorHandler when a handler panics (see Recover)
+type PanicError struct {
+	// Value passed to panic
+	Value any
+
+	// Stack of the goroutine at the moment of panic
+	Stack []byte
+
+	Method     string
+	Path       string
+	RemoteAddr string
+}
+
+func (e PanicError) Error() string {
+	return fmt.Sprintf("panic in %s %s: %v", e.Method, e.Path, e.Value)
+}
+
+// Recover returns handler which recovers from panics in next and passes
+// them as PanicError to the error handler of the request (see
+// WithErrorHandler), so InternalError is written to the client:
+//
+//	handler := endpoint.WithErrorHandler(endpoint.Recover(mux), errs)
+//
+// If the response headers were already written, the panic is only
+// reported and the connection is aborted. Panics with http.ErrAbortHandler
+// are not recovered.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoverWriter{ResponseWriter: w}
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+
+			err := PanicError{
+				Value:      v,
+				Stack:      debug.Stack(),
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				RemoteAddr: r.RemoteAddr,
+			}
+
+			h := errorHandler(r)
+			if rw.written {
+				h.report(r, err)
+
+				// Client must not take partial response as complete
+				panic(http.ErrAbortHandler)
+			}
+
+			h.Handle(w, r, err)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// recoverWriter tracks whether the response headers were written
+type recoverWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *recoverWriter) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recoverWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recoverWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.written = true
+		f.Flush()
+	}
+}
+
+func (w *recoverWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported")
+	}
+
+	w.written = true
+	return h.Hijack()
+}
+
+// Unwrap returns the original ResponseWriter (see http.ResponseController)
+func (w *recoverWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,122 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	var reported []error
+	errs := &ErrorHandler{Report: func(r *http.Request, err error) {
+		reported = append(reported, err)
+	}}
+
+	h := WithErrorHandler(Recover(HandlerFuncWithData(func(w http.ResponseWriter, r *http.Request) (any, error) {
+		var items map[string]int
+		items["boom"]++
+		return nil, nil
+	})), errs)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/items?id=1", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+
+	var apiErr ApiError
+	if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil || apiErr.Message != InternalError.Message {
+		t.Errorf("Expected InternalError, got %q", w.Body.String())
+	}
+
+	if len(reported) != 1 {
+		t.Fatalf("Expected panic to be reported once, got %v", reported)
+	}
+
+	var pe PanicError
+	if !errors.As(reported[0], &pe) {
+		t.Fatalf("Expected PanicError, got %T", reported[0])
+	}
+
+	if pe.Method != "POST" || pe.Path != "/items" || pe.RemoteAddr == "" {
+		t.Errorf("Unexpected request metadata: %+v", pe)
+	}
+
+	if !strings.Contains(string(pe.Stack), "TestRecover") {
+		t.Errorf("Expected stack of the handler, got %s", pe.Stack)
+	}
+
+	if !strings.Contains(pe.Error(), "assignment to entry in nil map") {
+		t.Errorf("Unexpected error message: %s", pe.Error())
+	}
+}
+
+func TestRecoverAfterWrite(t *testing.T) {
+	var reported []error
+	errs := &ErrorHandler{Report: func(r *http.Request, err error) {
+		reported = append(reported, err)
+	}}
+
+	h := WithErrorHandler(Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"items": [`))
+		panic("cannot encode item")
+	})), errs)
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("Expected connection to be aborted, got %v", v)
+		}
+
+		if len(reported) != 1 {
+			t.Errorf("Expected panic to be reported, got %v", reported)
+		}
+	}()
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items", nil))
+}
+
+func TestRecoverAbortHandler(t *testing.T) {
+	reported := false
+	errs := &ErrorHandler{Report: func(r *http.Request, err error) {
+		reported = true
+	}}
+
+	h := WithErrorHandler(Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})), errs)
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("Expected http.ErrAbortHandler to be re-panicked, got %v", v)
+		}
+
+		if reported {
+			t.Errorf("http.ErrAbortHandler must not be reported")
+		}
+	}()
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestRecoverServer(t *testing.T) {
+	srv := httptest.NewServer(Recover(HandlerFuncWithError(func(w http.ResponseWriter, r *http.Request) error {
+		panic("unexpected")
+	})))
+	defer srv.Close()
+
+	defer func(h *ErrorHandler) { DefaultErrorHandler = h }(DefaultErrorHandler)
+	DefaultErrorHandler = &ErrorHandler{Report: func(*http.Request, error) {}}
+
+	var res someStruct
+	err := (&RESTClient{BaseURL: srv.URL + "/"}).Get(context.Background(), "", &res)
+
+	var apiErr ApiError
+	if !errors.As(err, &apiErr) || apiErr.HttpStatus != http.StatusInternalServerError {
+		t.Errorf("Expected 500 ApiError, got %v", err)
+	}
+}
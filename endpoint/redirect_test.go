@@ -0,0 +1,67 @@
+package endpoint
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRedirectHTTPS(t *testing.T) {
+	tests := []struct {
+		method, target, host string
+		port                 int
+		code                 int
+		location             string
+	}{
+		{"GET", "/path?q=1", "example.com", 443, http.StatusMovedPermanently, "https://example.com/path?q=1"},
+		{"GET", "/", "example.com:80", 443, http.StatusMovedPermanently, "https://example.com/"},
+		{"HEAD", "/", "example.com:8080", 8443, http.StatusMovedPermanently, "https://example.com:8443/"},
+		{"POST", "/form", "example.com", 443, http.StatusPermanentRedirect, "https://example.com/form"},
+		{"GET", "/", "[::1]:80", 443, http.StatusMovedPermanently, "https://[::1]/"},
+		{"GET", "/", "[::1]:80", 8443, http.StatusMovedPermanently, "https://[::1]:8443/"},
+		{"GET", "/", "", 443, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+
+		RedirectHTTPS(tt.port).ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%s %s%s: expected status %d, got %d", tt.method, tt.host, tt.target, tt.code, w.Code)
+		}
+
+		if loc := w.Header().Get("Location"); loc != tt.location {
+			t.Errorf("%s %s%s: expected Location %q, got %q", tt.method, tt.host, tt.target, tt.location, loc)
+		}
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	handler := HSTS(textHandler("ok"), 365*24*time.Hour, true)
+
+	r := httptest.NewRequest("GET", "https://example.com/", nil)
+	r.TLS = &tls.ConnectionState{}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if h := w.Header().Get("Strict-Transport-Security"); h != "max-age=31536000; includeSubDomains" {
+		t.Errorf("Unexpected header over TLS: %q", h)
+	}
+
+	if w.Body.String() != "ok" {
+		t.Errorf("Expected response of the wrapped handler, got %q", w.Body.String())
+	}
+
+	r = httptest.NewRequest("GET", "http://example.com/", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if h := w.Header().Get("Strict-Transport-Security"); h != "" {
+		t.Errorf("Expected no header over plain HTTP, got %q", h)
+	}
+}
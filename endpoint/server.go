@@ -1,31 +1,288 @@
 package endpoint
 
 import (
+	"context"
+	"crypto/x509"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/fednep/goapilib/config/common"
 )
 
-// ServeForever starts HTTP server
-// returns on error or after server is terminated
-func ServeForever(cfg common.ServerConfig, handler http.Handler) error {
+// DefaultShutdownTimeout limits graceful shutdown when neither
+// ShutdownTimeout nor Timeout is configured
+const DefaultShutdownTimeout = 30 * time.Second
+
+// Server runs HTTP(S) server until the context is cancelled or the process
+// receives SIGINT or SIGTERM, then shuts it down gracefully:
+//
+//	srv := endpoint.Server{Config: cfg.Server, Handler: mux}
+//	srv.OnShutdown(func(ctx context.Context) error {
+//		return db.Close()
+//	})
+//
+//	if err := srv.Serve(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+type Server struct {
+	Config  common.ServerConfig
+	Handler http.Handler
+
+	// Listener is used instead of listening on the configured address,
+	// if set
+	Listener net.Listener
+
+	mu     sync.Mutex
+	hooks  []func(context.Context) error
+	checks []func(context.Context) error
+	certs  *common.CertLoader
+}
+
+// OnShutdown registers a function which is called after the server is
+// stopped. Functions are called in reverse order of registration, with
+// the context limited by the shutdown timeout.
+func (s *Server) OnShutdown(fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hooks = append(s.hooks, fn)
+}
+
+// OnHealthCheck registers a function which is called before each
+// watchdog ping sent to systemd (see WatchdogInterval). If it returns an
+// error, the ping is not sent and the error is reported in the status.
+func (s *Server) OnHealthCheck(fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checks = append(s.checks, fn)
+}
+
+// Serve starts the server and blocks until it is stopped.
+//
+// When ctx is done or SIGINT/SIGTERM is received, the server stops
+// accepting connections and waits for active requests to complete,
+// at most for Config.ShutdownTimeout. Shutdown hooks are called after that.
+//
+// Under systemd, readiness, shutdown and watchdog pings are reported with
+// Notify.
+//
+// Returns nil if the server was stopped cleanly.
+func (s *Server) Serve(ctx context.Context) error {
+	ln := s.Listener
+	if ln == nil {
+		var err error
+		ln, err = s.Config.Listen()
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	status := "Serving on " + ln.Addr().String()
+	return s.serve(ctx, ln, func() {
+		notify("READY=1", "STATUS="+status)
+		go watchdog(ctx, status, s.healthChecks)
+	})
+}
+
+// serve runs the server on ln, which is closed when serve returns.
+// ready is called once the server accepts connections.
+func (s *Server) serve(ctx context.Context, ln net.Listener, ready func()) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg := s.Config
+	server := cfg.Server(s.Handler)
 
-	server := cfg.Server(handler)
+	// Client addresses are read from PROXY protocol header, if enabled
+	ln = cfg.ProxyListener(ln)
 
+	if err := cfg.CheckFiles(); err != nil {
+		ln.Close()
+		return err
+	}
+
+	if cfg.UseTLS {
+		certs, err := cfg.CertLoader()
+		if err != nil {
+			ln.Close()
+			return err
+		}
+
+		tlsConfig, err := cfg.TLSConfigWith(certs)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		server.TLSConfig = tlsConfig
+
+		s.mu.Lock()
+		s.certs = certs
+		s.mu.Unlock()
+
+		// Rotated certificates are picked up until the server is stopped
+		go certs.Watch(ctx, cfg.ReloadInterval())
+	}
+
+	scheme := "HTTP"
 	if cfg.UseTLS {
-		log.Printf("Starting HTTPS server on: %s", server.Addr)
-		err := http.ListenAndServeTLS(
-			server.Addr,
-			cfg.CertFile,
-			cfg.KeyFile,
-			handler)
-		log.Printf("HTTPS server (%s) stopped: %s", server.Addr, err)
+		scheme = "HTTPS"
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("Starting %s server on: %s", scheme, ln.Addr())
+		if cfg.UseTLS {
+			// Certificate is provided by TLSConfig.GetCertificate
+			errCh <- server.ServeTLS(ln, "", "")
+		} else {
+			errCh <- server.Serve(ln)
+		}
+	}()
+	ready()
+
+	timeout := shutdownTimeout(cfg)
+
+	var err error
+	select {
+	case err = <-errCh:
+		log.Printf("%s server (%s) stopped: %s", scheme, ln.Addr(), err)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		s.runHooks(ctx)
+		return err
+
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down %s server (%s)", scheme, ln.Addr())
+	notify("STOPPING=1")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		// Connections which didn't complete in time are closed
+		server.Close()
+	}
+
+	if serveErr := <-errCh; serveErr != http.ErrServerClosed && err == nil {
+		err = serveErr
+	}
+
+	if hookErr := s.runHooks(shutdownCtx); err == nil {
+		err = hookErr
+	}
+
+	if err != nil {
+		log.Printf("%s server (%s) stopped: %s", scheme, ln.Addr(), err)
 		return err
 	}
 
-	log.Printf("Starting HTTP server on: %s", server.Addr)
-	err := server.ListenAndServe()
-	log.Printf("HTTP Server (%s) stopped: %s", server.Addr, err)
-	return err
+	log.Printf("%s server (%s) stopped", scheme, ln.Addr())
+	return nil
+}
+
+// shutdownTimeout returns the time given to the server to stop gracefully
+func shutdownTimeout(cfg common.ServerConfig) time.Duration {
+	if timeout := cfg.GracefulTimeout(); timeout > 0 {
+		return timeout
+	}
+	return DefaultShutdownTimeout
+}
+
+// CertExpiry returns expiration time of the certificate currently served,
+// for example to report it in health checks. Returns zero time if TLS is
+// not enabled or the server is not started.
+func (s *Server) CertExpiry() time.Time {
+	s.mu.Lock()
+	certs := s.certs
+	s.mu.Unlock()
+
+	if certs == nil {
+		return time.Time{}
+	}
+
+	return certs.NotAfter()
+}
+
+// healthChecks returns health checks of the server
+func (s *Server) healthChecks() []func(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]func(context.Context) error{}, s.checks...)
+}
+
+// runHooks calls shutdown hooks of the server
+func (s *Server) runHooks(ctx context.Context) error {
+	s.mu.Lock()
+	hooks := append([]func(context.Context) error{}, s.hooks...)
+	s.mu.Unlock()
+
+	return runHooks(ctx, hooks)
+}
+
+// runHooks calls hooks in reverse order and returns the first error,
+// other errors are logged
+func runHooks(ctx context.Context, hooks []func(context.Context) error) error {
+	var first error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		err := hooks[i](ctx)
+		if err == nil {
+			continue
+		}
+
+		if first == nil {
+			first = err
+		} else {
+			log.Printf("Shutdown hook failed: %s", err)
+		}
+	}
+
+	return first
+}
+
+// ServeForever starts HTTP server
+// returns on error or after server is terminated.
+//
+// Server is shut down gracefully on SIGINT or SIGTERM (see Server).
+func ServeForever(cfg common.ServerConfig, handler http.Handler) error {
+	srv := Server{Config: cfg, Handler: handler}
+	return srv.Serve(context.Background())
+}
+
+// PeerIdentity returns certificate of the client verified by the server
+// configured with mutual TLS (see common.ServerConfig.ClientAuth).
+//
+// Returns false if the connection is not encrypted or client certificate
+// was not verified.
+func PeerIdentity(r *http.Request) (*x509.Certificate, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	return r.TLS.VerifiedChains[0][0], true
+}
+
+// ProxyHeader returns connection information passed by the load balancer
+// with PROXY protocol (see common.ServerConfig.ProxyProtocol), for
+// example TLS parameters of the client connection. r.RemoteAddr already
+// holds the address of the client.
+//
+// Returns false if PROXY protocol is not enabled or the load balancer
+// is not trusted.
+func ProxyHeader(r *http.Request) (*common.ProxyHeader, bool) {
+	return common.ProxyHeaderFromContext(r.Context())
 }
@@ -0,0 +1,433 @@
+package endpoint
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fednep/goapilib/config"
+	"github.com/fednep/goapilib/config/common"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	der  []byte
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Cannot generate key: %s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
+	}
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Cannot create certificate: %s", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Cannot parse certificate: %s", err)
+	}
+
+	return &testCert{cert: cert, der: der, key: key}
+}
+
+func (c *testCert) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})
+}
+
+func (c *testCert) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("Cannot marshal key: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.certPEM(), c.keyPEM(t))
+	if err != nil {
+		t.Fatalf("Cannot load key pair: %s", err)
+	}
+	return cert
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	fn := filepath.Join(dir, name)
+	if err := os.WriteFile(fn, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := newTestCert(t, "Test CA", nil, x509.ExtKeyUsageAny)
+	server := newTestCert(t, "localhost", ca, x509.ExtKeyUsageServerAuth)
+	billing := newTestCert(t, "billing.internal", ca, x509.ExtKeyUsageClientAuth)
+	other := newTestCert(t, "other.external", ca, x509.ExtKeyUsageClientAuth)
+	untrusted := newTestCert(t, "billing.internal", newTestCert(t, "Other CA", nil, x509.ExtKeyUsageAny), x509.ExtKeyUsageClientAuth)
+	selfSigned := newTestCert(t, "billing.internal", nil, x509.ExtKeyUsageClientAuth)
+
+	cfg := common.ServerConfig{
+		Address:       "127.0.0.1",
+		Port:          8443,
+		UseTLS:        true,
+		CertFile:      writeFile(t, dir, "server.pem", server.certPEM()),
+		KeyFile:       writeFile(t, dir, "server.key", server.keyPEM(t)),
+		ClientAuth:    "verify",
+		ClientCAFile:  writeFile(t, dir, "ca.pem", ca.certPEM()),
+		ClientAllowed: []string{"*.internal"},
+	}
+
+	if err := cfg.IsValid(); err != nil {
+		t.Fatalf("Config is not valid: %s", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %s", err)
+	}
+
+	srv := Server{
+		Config: cfg,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cert, ok := PeerIdentity(r)
+			if !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, "%s %s", r.Proto, cert.Subject.CommonName)
+		}),
+		Listener: ln,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-serveErr; err != nil {
+			t.Errorf("Server stopped with error: %s", err)
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	get := func(client *testCert) (string, error) {
+		tlsConfig := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+		if client != nil {
+			tlsConfig.Certificates = []tls.Certificate{client.tlsCertificate(t)}
+		}
+
+		c := http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, ForceAttemptHTTP2: true}}
+		resp, err := c.Get("https://" + ln.Addr().String() + "/")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	// Connection is negotiated with ALPN as HTTP/2
+	if name, err := get(billing); err != nil || name != "HTTP/2.0 billing.internal" {
+		t.Errorf("Expected allowed client to be identified, got %q, %v", name, err)
+	}
+
+	if expiry := srv.CertExpiry(); !expiry.Equal(server.cert.NotAfter) {
+		t.Errorf("Expected certificate expiry %s, got %s", server.cert.NotAfter, expiry)
+	}
+
+	for _, client := range []*testCert{nil, other, untrusted, selfSigned} {
+		if _, err := get(client); err == nil {
+			t.Errorf("Expected client %v to be rejected", client)
+		}
+	}
+}
+
+func TestPeerIdentityWithoutTLS(t *testing.T) {
+	if _, ok := PeerIdentity(&http.Request{}); ok {
+		t.Errorf("Expected no identity for plain HTTP request")
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %s", err)
+	}
+
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprint(w, "done")
+	})
+
+	srv := Server{
+		Config:   common.ServerConfig{Port: 8080, ShutdownTimeout: config.Duration(5 * time.Second)},
+		Handler:  mux,
+		Listener: ln,
+	}
+
+	var order []int
+	for i := 1; i <= 3; i++ {
+		i := i
+		srv.OnShutdown(func(ctx context.Context) error {
+			order = append(order, i)
+			return nil
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ctx) }()
+
+	respCh := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			respCh <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		respCh <- string(body)
+	}()
+
+	<-started
+	cancel()
+
+	if err := <-serveErr; err != nil {
+		t.Errorf("Expected clean stop, got %s", err)
+	}
+
+	if body := <-respCh; body != "done" {
+		t.Errorf("In-flight request was not completed: %s", body)
+	}
+
+	if fmt.Sprint(order) != "[3 2 1]" {
+		t.Errorf("Expected hooks to be called in reverse order, got %v", order)
+	}
+
+	if _, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Errorf("Expected server to stop accepting connections")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %s", err)
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	srv := Server{
+		Config: common.ServerConfig{Port: 8080, ShutdownTimeout: config.Duration(50 * time.Millisecond)},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}),
+		Listener: ln,
+	}
+
+	hookErr := errors.New("hook failed")
+	srv.OnShutdown(func(ctx context.Context) error { return hookErr })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ctx) }()
+
+	go http.Get("http://" + ln.Addr().String() + "/")
+	<-started
+	cancel()
+
+	if err := <-serveErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestServeBindError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %s", err)
+	}
+	defer ln.Close()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	srv := Server{Config: common.ServerConfig{Address: "127.0.0.1", Port: port}, Handler: http.NotFoundHandler()}
+
+	if err := srv.Serve(context.Background()); err == nil {
+		t.Errorf("Expected error when the address is in use")
+	}
+}
+
+func TestDevTLSServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %s", err)
+	}
+
+	dir := t.TempDir()
+	srv := Server{
+		Config: common.ServerConfig{Port: 8443, UseTLS: true, DevTLS: true, DevTLSCacheDir: dir},
+		Handler: HandlerFuncWithData(func(w http.ResponseWriter, r *http.Request) (any, error) {
+			return someStruct{Res: "secure"}, nil
+		}),
+		Listener: ln,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx)
+
+	client, err := NewTLSClient(filepath.Join(dir, common.DevCAFile))
+	for i := 0; err != nil && i < 100; i++ {
+		// CA is written when the server starts
+		time.Sleep(10 * time.Millisecond)
+		client, err = NewTLSClient(filepath.Join(dir, common.DevCAFile))
+	}
+	if err != nil {
+		t.Fatalf("Cannot create client: %s", err)
+	}
+
+	api := RESTClient{BaseURL: "https://" + ln.Addr().String(), HTTPClient: client}
+
+	var res someStruct
+	if err := api.Get(context.Background(), "/", &res); err != nil || res.Res != "secure" {
+		t.Errorf("Expected response over TLS, got %v, %v", res, err)
+	}
+}
+
+func TestServeUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "sock")
+	if err != nil {
+		t.Fatalf("Cannot create dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "api.sock")
+	srv := Server{
+		Config:  common.ServerConfig{Address: common.UnixPrefix + fn},
+		Handler: textHandler("unix"),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ctx) }()
+
+	client := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", fn)
+		},
+	}}
+
+	resp, err := client.Get("http://unix/")
+	for i := 0; err != nil && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+		resp, err = client.Get("http://unix/")
+	}
+	if err != nil {
+		t.Fatalf("GET: %s", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "unix" {
+		t.Errorf("Unexpected response: %q", body)
+	}
+
+	cancel()
+	if err := <-serveErr; err != nil {
+		t.Errorf("Expected clean stop, got %s", err)
+	}
+
+	if _, err := os.Stat(fn); !os.IsNotExist(err) {
+		t.Errorf("Expected socket to be removed after stop")
+	}
+}
+
+func TestProxyProtocol(t *testing.T) {
+	ln := testListener(t)
+	srv := Server{
+		Config: common.ServerConfig{Port: 8080, ProxyProtocol: true, ProxyTrusted: config.List{"127.0.0.1"}},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h, ok := ProxyHeader(r)
+			if !ok {
+				http.Error(w, "no PROXY header", http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintf(w, "%s v%d", r.RemoteAddr, h.Version)
+		}),
+		Listener: ln,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Cannot connect: %s", err)
+	}
+	defer conn.Close()
+
+	fmt.Fprint(conn, "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n")
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n")
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Cannot read response: %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "192.0.2.1:56324 v1" {
+		t.Errorf("Expected client address from PROXY header, got %q", body)
+	}
+}
@@ -2,4 +2,4 @@ module github.com/fednep/goapilib
 
 go 1.18
 
-require github.com/BurntSushi/toml v1.2.1 // indirect
+require github.com/BurntSushi/toml v1.2.1